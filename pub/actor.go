@@ -38,6 +38,10 @@ type Actor interface {
 	// If the Actor was constructed with the Federated Protocol enabled,
 	// side effects will occur.
 	//
+	// If the delegate provides an InboxQueue, the activity is instead
+	// enqueued and the http.StatusAccepted status code is written in the
+	// response. Side effects occur later, when the InboxQueue processes it.
+	//
 	// If the Federated Protocol is not enabled, writes the
 	// http.StatusMethodNotAllowed status code in the response. No side
 	// effects occur.
@@ -55,7 +59,13 @@ type Actor interface {
 	// application to determine the correct authorization of the request and
 	// the resulting OrderedCollection to respond with. The Actor handles
 	// serializing this OrderedCollection and responding with the correct
-	// headers and http.StatusOK.
+	// headers and http.StatusOK. Conditional requests for an unchanged
+	// OrderedCollection are answered with http.StatusNotModified.
+	//
+	// If the application is an InboxPager, the Actor instead serves a
+	// top-level OrderedCollection linking to its first page, and passes
+	// the parsed 'page', 'max_id', and 'min_id' query parameters of page
+	// requests to the application as a PageRequest.
 	GetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
 	// PostOutbox returns true if the request was handled as an ActivityPub
 	// POST to an actor's outbox. If false, the request was not an
@@ -89,7 +99,13 @@ type Actor interface {
 	// application to determine the correct authorization of the request and
 	// the resulting OrderedCollection to respond with. The Actor handles
 	// serializing this OrderedCollection and responding with the correct
-	// headers and http.StatusOK.
+	// headers and http.StatusOK. Conditional requests for an unchanged
+	// OrderedCollection are answered with http.StatusNotModified.
+	//
+	// If the application is an OutboxPager, the Actor instead serves a
+	// top-level OrderedCollection linking to its first page, and passes
+	// the parsed 'page', 'max_id', and 'min_id' query parameters of page
+	// requests to the application as a PageRequest.
 	GetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
 }
 
@@ -112,3 +128,65 @@ type FederatingActor interface {
 	// care should be used to not call this method if only C2S is supported.
 	Send(c context.Context, outbox *url.URL, t vocab.Type) (Activity, error)
 }
+
+// SharedInboxActor is optionally implemented by a FederatingActor in order to
+// handle POST requests to this server's shared inbox.
+//
+// Note that the FederatingActors created by NewActor, NewFederatingActor, and
+// NewCustomActor implement this interface.
+type SharedInboxActor interface {
+	// PostSharedInbox returns true if the request was handled as an
+	// ActivityPub POST to this server's shared inbox. If false, the
+	// request was not an ActivityPub request and may still be handled by
+	// the caller in another way.
+	//
+	// If the error is nil, then the ResponseWriter's headers and response
+	// has already been written. If a non-nil error is returned, then no
+	// response has been written.
+	//
+	// The activity is authenticated and parsed once, then added to the
+	// inbox of every local actor it is addressed to. Side effects storing
+	// its data, and inbox forwarding, occur only once. Side effects
+	// applying to the actor owning an inbox, such as accepting a Follow,
+	// occur for every inbox.
+	//
+	// If the delegate provides an InboxQueue, the activity is instead
+	// enqueued for its local recipients and the http.StatusAccepted status
+	// code is written in the response. Side effects occur later, when the
+	// InboxQueue processes it.
+	//
+	// If the Federated Protocol is not enabled, or the delegate does not
+	// implement SharedInboxDelegateActor, writes the
+	// http.StatusMethodNotAllowed status code in the response. No side
+	// effects occur.
+	PostSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
+}
+
+// FollowApprovalActor is optionally implemented by a FederatingActor in order
+// to approve or deny Follow requests queued with OnFollowQueueForApproval.
+//
+// Note that the FederatingActors created by NewActor, NewFederatingActor, and
+// NewCustomActor implement this interface.
+type FollowApprovalActor interface {
+	// PendingFollows returns the Follow requests awaiting approval by the
+	// actor owning the inbox, when using OnFollowQueueForApproval.
+	//
+	// Returns an error if the Federated Protocol is not enabled, or the
+	// delegate does not implement FollowApprovalDelegateActor.
+	PendingFollows(c context.Context, inboxIRI *url.URL) ([]vocab.ActivityStreamsFollow, error)
+	// AcceptFollow accepts a pending Follow request of the actor owning the
+	// inbox. The Follow's actors are added to the followers collection,
+	// and an Accept is delivered to them, as for
+	// OnFollowAutomaticallyAccept.
+	//
+	// Returns an error if the Federated Protocol is not enabled, or the
+	// delegate does not implement FollowApprovalDelegateActor.
+	AcceptFollow(c context.Context, inboxIRI, followIRI *url.URL) error
+	// RejectFollow rejects a pending Follow request of the actor owning the
+	// inbox. A Reject is delivered to the Follow's actors, as for
+	// OnFollowAutomaticallyReject.
+	//
+	// Returns an error if the Federated Protocol is not enabled, or the
+	// delegate does not implement FollowApprovalDelegateActor.
+	RejectFollow(c context.Context, inboxIRI, followIRI *url.URL) error
+}
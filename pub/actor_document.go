@@ -0,0 +1,270 @@
+package pub
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/http"
+	"net/url"
+)
+
+// defaultPublicKeyFragment is the fragment identifying an actor's key when no
+// PublicKeyId is given.
+const defaultPublicKeyFragment = "main-key"
+
+// ActorDescriptor describes a local actor, from which NewActorHandler builds
+// the actor's ActivityStreams document.
+//
+// The 'outbox' of the actor is not part of the descriptor: it is obtained
+// from the Database using the Inbox, so that the served document always
+// agrees with the Database.
+type ActorDescriptor struct {
+	// Type is the ActivityStreams type of the actor: "Person",
+	// "Application", "Group", "Organization", or "Service". Defaults to
+	// "Person".
+	Type string
+	// Id is the IRI of the actor. Required.
+	Id *url.URL
+	// Inbox is the IRI of the actor's inbox. Required.
+	Inbox *url.URL
+	// Followers is the IRI of the actor's followers collection, if any.
+	Followers *url.URL
+	// Following is the IRI of the actor's following collection, if any.
+	Following *url.URL
+	// Liked is the IRI of the actor's liked collection, if any.
+	Liked *url.URL
+	// SharedInbox is the IRI of the server's shared inbox, if any.
+	SharedInbox *url.URL
+	// PreferredUsername is the actor's username, if any.
+	PreferredUsername string
+	// Name is the actor's display name, if any.
+	Name string
+	// Summary is the actor's biography, if any.
+	Summary string
+	// PublicKey is the public key used to verify the actor's HTTP
+	// Signatures, if any.
+	PublicKey crypto.PublicKey
+	// PublicKeyId is the IRI of the public key. Defaults to the actor's Id
+	// with a "main-key" fragment.
+	PublicKeyId *url.URL
+}
+
+// ActorLookup finds the descriptor of the local actor with the IRI.
+//
+// A nil descriptor and nil error means the IRI is not a local actor.
+type ActorLookup func(c context.Context, actorIRI *url.URL) (actor *ActorDescriptor, err error)
+
+// actorDocumenter is an ActivityStreams actor type with the properties set
+// by ToActorDocument.
+type actorDocumenter interface {
+	vocab.Type
+	SetActivityStreamsInbox(i vocab.ActivityStreamsInboxProperty)
+	SetActivityStreamsOutbox(i vocab.ActivityStreamsOutboxProperty)
+	SetActivityStreamsFollowers(i vocab.ActivityStreamsFollowersProperty)
+	SetActivityStreamsFollowing(i vocab.ActivityStreamsFollowingProperty)
+	SetActivityStreamsLiked(i vocab.ActivityStreamsLikedProperty)
+	SetActivityStreamsPreferredUsername(i vocab.ActivityStreamsPreferredUsernameProperty)
+	SetActivityStreamsName(i vocab.ActivityStreamsNameProperty)
+	SetActivityStreamsSummary(i vocab.ActivityStreamsSummaryProperty)
+	SetW3IDSecurityV1PublicKey(i vocab.W3IDSecurityV1PublicKeyProperty)
+}
+
+// newActorType creates an empty actor of the ActivityStreams type.
+func newActorType(typeName string) (actorDocumenter, error) {
+	switch typeName {
+	case "", "Person":
+		return streams.NewActivityStreamsPerson(), nil
+	case "Application":
+		return streams.NewActivityStreamsApplication(), nil
+	case "Group":
+		return streams.NewActivityStreamsGroup(), nil
+	case "Organization":
+		return streams.NewActivityStreamsOrganization(), nil
+	case "Service":
+		return streams.NewActivityStreamsService(), nil
+	default:
+		return nil, fmt.Errorf("%q is not an ActivityStreams actor type", typeName)
+	}
+}
+
+// ToActorDocument builds the serialized ActivityStreams document of the actor,
+// including its 'publicKey' and the 'sharedInbox' of its 'endpoints'.
+//
+// The actor's 'outbox' is obtained from the Database, which must also agree
+// that the Inbox belongs to the actor.
+func ToActorDocument(c context.Context, db Database, a *ActorDescriptor) (m map[string]interface{}, err error) {
+	if a.Id == nil || a.Inbox == nil {
+		err = fmt.Errorf("actor descriptor must have an Id and Inbox")
+		return
+	}
+	// Lock and obtain the actor and outbox of the inbox
+	err = db.Lock(c, a.Inbox)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock not deferred
+	actorIRI, err := db.ActorForInbox(c, a.Inbox)
+	if err != nil {
+		db.Unlock(c, a.Inbox)
+		return
+	}
+	outboxIRI, err := db.OutboxForInbox(c, a.Inbox)
+	if err != nil {
+		db.Unlock(c, a.Inbox)
+		return
+	}
+	db.Unlock(c, a.Inbox)
+	// Unlock must have been called by this point and in every
+	// branch above
+	if actorIRI.String() != a.Id.String() {
+		err = fmt.Errorf("inbox %s belongs to actor %s, not %s", a.Inbox, actorIRI, a.Id)
+		return
+	}
+	return toActorDocument(a, outboxIRI)
+}
+
+// toActorDocument builds the serialized ActivityStreams document of the actor
+// with the outbox.
+func toActorDocument(a *ActorDescriptor, outboxIRI *url.URL) (m map[string]interface{}, err error) {
+	actor, err := newActorType(a.Type)
+	if err != nil {
+		return
+	}
+	id := streams.NewJSONLDIdProperty()
+	id.Set(a.Id)
+	actor.SetJSONLDId(id)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(a.Inbox)
+	actor.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(outboxIRI)
+	actor.SetActivityStreamsOutbox(outbox)
+	if a.Followers != nil {
+		followers := streams.NewActivityStreamsFollowersProperty()
+		followers.SetIRI(a.Followers)
+		actor.SetActivityStreamsFollowers(followers)
+	}
+	if a.Following != nil {
+		following := streams.NewActivityStreamsFollowingProperty()
+		following.SetIRI(a.Following)
+		actor.SetActivityStreamsFollowing(following)
+	}
+	if a.Liked != nil {
+		liked := streams.NewActivityStreamsLikedProperty()
+		liked.SetIRI(a.Liked)
+		actor.SetActivityStreamsLiked(liked)
+	}
+	if len(a.PreferredUsername) > 0 {
+		username := streams.NewActivityStreamsPreferredUsernameProperty()
+		username.SetXMLSchemaString(a.PreferredUsername)
+		actor.SetActivityStreamsPreferredUsername(username)
+	}
+	if len(a.Name) > 0 {
+		name := streams.NewActivityStreamsNameProperty()
+		name.AppendXMLSchemaString(a.Name)
+		actor.SetActivityStreamsName(name)
+	}
+	if len(a.Summary) > 0 {
+		summary := streams.NewActivityStreamsSummaryProperty()
+		summary.AppendXMLSchemaString(a.Summary)
+		actor.SetActivityStreamsSummary(summary)
+	}
+	if a.PublicKey != nil {
+		var pk vocab.W3IDSecurityV1PublicKeyProperty
+		pk, err = toPublicKeyProperty(a)
+		if err != nil {
+			return
+		}
+		actor.SetW3IDSecurityV1PublicKey(pk)
+	}
+	m, err = streams.Serialize(actor)
+	if err != nil {
+		return
+	}
+	// The 'endpoints' property is not part of the generated vocabulary.
+	if a.SharedInbox != nil {
+		m[endpointsProperty] = map[string]interface{}{
+			sharedInboxProperty: a.SharedInbox.String(),
+		}
+	}
+	return
+}
+
+// toPublicKeyProperty creates the 'publicKey' property of the actor, owned by
+// the actor and with the key encoded as PEM.
+func toPublicKeyProperty(a *ActorDescriptor) (vocab.W3IDSecurityV1PublicKeyProperty, error) {
+	der, err := x509.MarshalPKIXPublicKey(a.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyIRI := a.PublicKeyId
+	if keyIRI == nil {
+		k := *a.Id
+		k.Fragment = defaultPublicKeyFragment
+		keyIRI = &k
+	}
+	key := streams.NewW3IDSecurityV1PublicKey()
+	keyId := streams.NewJSONLDIdProperty()
+	keyId.Set(keyIRI)
+	key.SetJSONLDId(keyId)
+	owner := streams.NewW3IDSecurityV1OwnerProperty()
+	owner.Set(a.Id)
+	key.SetW3IDSecurityV1Owner(owner)
+	keyPem := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	keyPem.Set(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	key.SetW3IDSecurityV1PublicKeyPem(keyPem)
+	pk := streams.NewW3IDSecurityV1PublicKeyProperty()
+	pk.AppendW3IDSecurityV1PublicKey(key)
+	return pk, nil
+}
+
+// NewActorHandler creates a HandlerFunc to serve the ActivityStreams documents
+// of local actors, built by ToActorDocument from the descriptors found by the
+// lookup.
+//
+// Requests for IRIs that are not local actors are not handled, so the caller
+// may continue with another HandlerFunc, such as one created by
+// NewActivityStreamsHandler.
+func NewActorHandler(db Database, clock Clock, lookup ActorLookup) HandlerFunc {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not an ActivityPub GET request
+		if !isActivityPubGet(r) {
+			return
+		}
+		actor, err := lookup(c, requestId(r))
+		if err != nil || actor == nil {
+			return
+		}
+		isASRequest = true
+		m, err := ToActorDocument(c, db, actor)
+		if err != nil {
+			return
+		}
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return
+		}
+		// Construct the response.
+		addResponseHeaders(w.Header(), clock, raw)
+		addCachingHeaders(c, w.Header(), nil, nil, raw)
+		// Write the response, unless the requester has it already.
+		if isNotModified(r, w.Header()) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		n, err := w.Write(raw)
+		if err != nil {
+			return
+		} else if n != len(raw) {
+			err = fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+			return
+		}
+		return
+	}
+}
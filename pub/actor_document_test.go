@@ -0,0 +1,112 @@
+package pub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestActorHandler tests serving actor documents.
+func TestActorHandler(t *testing.T) {
+	const (
+		testActorIRI       = "https://example.com/addison"
+		testSharedInboxIRI = "https://example.com/inbox"
+	)
+	ctx := context.Background()
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor := &ActorDescriptor{
+		Id:                mustParse(testActorIRI),
+		Inbox:             mustParse(testMyInboxIRI),
+		Followers:         mustParse(testActorIRI + "/followers"),
+		SharedInbox:       mustParse(testSharedInboxIRI),
+		PreferredUsername: "addison",
+		PublicKey:         &priv.PublicKey,
+	}
+	lookup := func(c context.Context, actorIRI *url.URL) (*ActorDescriptor, error) {
+		if actorIRI.String() == testActorIRI {
+			return descriptor, nil
+		}
+		return nil, nil
+	}
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, h HandlerFunc) {
+		db = NewMockDatabase(ctl)
+		c := NewMockClock(ctl)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		h = NewActorHandler(db, c, lookup)
+		return
+	}
+	t.Run("ServesActorDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, h := setupFn(ctl)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testActorIRI), nil),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+		)
+		resp := httptest.NewRecorder()
+		// Run
+		handled, err := h(ctx, resp, toAPRequest(httptest.NewRequest("GET", testActorIRI, nil)))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		var m map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, m["type"], "Person")
+		assertEqual(t, m["id"], testActorIRI)
+		assertEqual(t, m["inbox"], testMyInboxIRI)
+		assertEqual(t, m["outbox"], testMyOutboxIRI)
+		assertEqual(t, m["followers"], testActorIRI+"/followers")
+		assertEqual(t, m["preferredUsername"], "addison")
+		assertEqual(t, m["endpoints"].(map[string]interface{})["sharedInbox"], testSharedInboxIRI)
+		key := m["publicKey"].(map[string]interface{})
+		assertEqual(t, key["id"], testActorIRI+"#main-key")
+		assertEqual(t, key["owner"], testActorIRI)
+		assertEqual(t, strings.HasPrefix(key["publicKeyPem"].(string), "-----BEGIN PUBLIC KEY-----"), true)
+	})
+	t.Run("ErrorsWhenInboxBelongsToAnotherActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, h := setupFn(ctl)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testFederatedActorIRI), nil),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+		)
+		resp := httptest.NewRecorder()
+		// Run
+		handled, err := h(ctx, resp, toAPRequest(httptest.NewRequest("GET", testActorIRI, nil)))
+		// Verify
+		assertNotEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Body.Len(), 0)
+	})
+	t.Run("IgnoresOtherIRIs", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl)
+		// Run
+		handled, err := h(ctx, httptest.NewRecorder(), toAPRequest(httptest.NewRequest("GET", testPersonIRI, nil)))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+}
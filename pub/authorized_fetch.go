@@ -0,0 +1,217 @@
+package pub
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/http"
+	"net/url"
+)
+
+// RequestVerifier authenticates the actor that signed a request.
+//
+// It is implemented by HttpSigVerifier.
+type RequestVerifier interface {
+	// Verify returns the IRI of the actor that signed the request, or an
+	// error if the request is not authentic.
+	Verify(c context.Context, r *http.Request) (signer *url.URL, err error)
+}
+
+// RequestVerifier must be implemented by HttpSigVerifier.
+var _ RequestVerifier = &HttpSigVerifier{}
+
+// AuthorizedFetch configures a HandlerFunc created by
+// NewAuthorizedFetchHandler.
+type AuthorizedFetch struct {
+	// Verifier authenticates the signer of a request. Required.
+	Verifier RequestVerifier
+	// UnauthenticatedStatus is written when a request for an object that
+	// is not public is unsigned, or its signature cannot be verified.
+	// Defaults to http.StatusUnauthorized.
+	UnauthenticatedStatus int
+	// ForbiddenStatus is written when the signer of a request is not
+	// addressed by the object. Defaults to http.StatusForbidden. Use
+	// http.StatusNotFound to not reveal that the object exists.
+	ForbiddenStatus int
+}
+
+// NewAuthorizedFetchHandler creates a HandlerFunc that serves ActivityStreams
+// data like one created by NewActivityStreamsHandler, but only to the actors
+// the data is addressed to.
+//
+// Objects addressed to the Public collection, and objects without any of the
+// 'to', 'bto', 'cc', 'bcc', or 'audience' properties such as actors and
+// collections, are served to anyone. Tombstones are also served to anyone.
+// Other objects are served only to requests signed by an actor that is
+// either addressed by the object, is one of its 'attributedTo' or 'actor', or
+// follows one of them when their followers collection is addressed. Only the
+// followers collections of actors owned by the Database are expanded.
+func NewAuthorizedFetchHandler(db Database, clock Clock, af AuthorizedFetch) HandlerFunc {
+	if af.UnauthenticatedStatus == 0 {
+		af.UnauthenticatedStatus = http.StatusUnauthorized
+	}
+	if af.ForbiddenStatus == 0 {
+		af.ForbiddenStatus = http.StatusForbidden
+	}
+	return newActivityStreamsHandler(db, clock, func(c context.Context, r *http.Request, t vocab.Type) (status int, err error) {
+		if streams.IsOrExtendsActivityStreamsTombstone(t) {
+			return
+		}
+		addressed, err := getAudience(t)
+		if err != nil || addressed == nil || containsPublic(addressed) {
+			return
+		}
+		signer, authErr := af.Verifier.Verify(c, r)
+		if authErr != nil {
+			status = af.UnauthenticatedStatus
+			return
+		}
+		authors, err := getAuthors(t)
+		if err != nil {
+			return
+		}
+		for _, iri := range append(addressed, authors...) {
+			if iri.String() == signer.String() {
+				return
+			}
+		}
+		var follows bool
+		follows, err = followsAddressedAuthor(c, db, signer, authors, addressed)
+		if err != nil {
+			return
+		} else if !follows {
+			status = af.ForbiddenStatus
+		}
+		return
+	})
+}
+
+// getAudience returns the IRIs in the 'to', 'bto', 'cc', 'bcc', and 'audience'
+// properties of the type. It is nil if none of the properties are set.
+func getAudience(t vocab.Type) (r []*url.URL, err error) {
+	appendIds := func(n int, at func(int) IdProperty) error {
+		if r == nil && n > 0 {
+			r = []*url.URL{}
+		}
+		for i := 0; i < n; i++ {
+			iri, err := ToId(at(i))
+			if err != nil {
+				return err
+			}
+			r = append(r, iri)
+		}
+		return nil
+	}
+	if v, ok := t.(toer); ok && v.GetActivityStreamsTo() != nil {
+		p := v.GetActivityStreamsTo()
+		if err = appendIds(p.Len(), func(i int) IdProperty { return p.At(i) }); err != nil {
+			return
+		}
+	}
+	if v, ok := t.(btoer); ok && v.GetActivityStreamsBto() != nil {
+		p := v.GetActivityStreamsBto()
+		if err = appendIds(p.Len(), func(i int) IdProperty { return p.At(i) }); err != nil {
+			return
+		}
+	}
+	if v, ok := t.(ccer); ok && v.GetActivityStreamsCc() != nil {
+		p := v.GetActivityStreamsCc()
+		if err = appendIds(p.Len(), func(i int) IdProperty { return p.At(i) }); err != nil {
+			return
+		}
+	}
+	if v, ok := t.(bccer); ok && v.GetActivityStreamsBcc() != nil {
+		p := v.GetActivityStreamsBcc()
+		if err = appendIds(p.Len(), func(i int) IdProperty { return p.At(i) }); err != nil {
+			return
+		}
+	}
+	if v, ok := t.(audiencer); ok && v.GetActivityStreamsAudience() != nil {
+		p := v.GetActivityStreamsAudience()
+		if err = appendIds(p.Len(), func(i int) IdProperty { return p.At(i) }); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getAuthors returns the IRIs in the 'attributedTo' and 'actor' properties of
+// the type.
+func getAuthors(t vocab.Type) (r []*url.URL, err error) {
+	if v, ok := t.(attributedToer); ok && v.GetActivityStreamsAttributedTo() != nil {
+		p := v.GetActivityStreamsAttributedTo()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			var iri *url.URL
+			if iri, err = ToId(iter); err != nil {
+				return
+			}
+			r = append(r, iri)
+		}
+	}
+	if v, ok := t.(actorer); ok && v.GetActivityStreamsActor() != nil {
+		p := v.GetActivityStreamsActor()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			var iri *url.URL
+			if iri, err = ToId(iter); err != nil {
+				return
+			}
+			r = append(r, iri)
+		}
+	}
+	return
+}
+
+// followsAddressedAuthor determines whether the signer is in the followers
+// collection of one of the authors owned by the Database, when that
+// collection is addressed.
+func followsAddressedAuthor(c context.Context, db Database, signer *url.URL, authors, addressed []*url.URL) (follows bool, err error) {
+	isAddressed := make(map[string]bool, len(addressed))
+	for _, iri := range addressed {
+		isAddressed[iri.String()] = true
+	}
+	for _, author := range authors {
+		// Lock and obtain the followers of the author, if local.
+		err = db.Lock(c, author)
+		if err != nil {
+			return
+		}
+		// WARNING: Unlock not deferred
+		var owns bool
+		owns, err = db.Owns(c, author)
+		if err != nil || !owns {
+			db.Unlock(c, author)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		var followers vocab.ActivityStreamsCollection
+		followers, err = db.Followers(c, author)
+		db.Unlock(c, author)
+		// Unlock must have been called by this point and in every
+		// branch above
+		if err != nil {
+			return
+		}
+		var id *url.URL
+		if id, err = GetId(followers); err != nil {
+			return
+		} else if !isAddressed[id.String()] {
+			continue
+		}
+		items := followers.GetActivityStreamsItems()
+		if items == nil {
+			continue
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			var iri *url.URL
+			if iri, err = ToId(iter); err != nil {
+				return
+			} else if iri.String() == signer.String() {
+				follows = true
+				return
+			}
+		}
+	}
+	return
+}
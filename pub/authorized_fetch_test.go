@@ -0,0 +1,144 @@
+package pub
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// staticVerifier is a RequestVerifier with a fixed outcome.
+type staticVerifier struct {
+	signer *url.URL
+	err    error
+}
+
+func (s staticVerifier) Verify(c context.Context, r *http.Request) (*url.URL, error) {
+	return s.signer, s.err
+}
+
+// TestAuthorizedFetchHandler tests serving objects only to their audience.
+func TestAuthorizedFetchHandler(t *testing.T) {
+	const (
+		testAuthorIRI    = "https://example.com/addison"
+		testFollowersIRI = "https://example.com/addison/followers"
+	)
+	ctx := context.Background()
+	toNote := func(to string) vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		note.SetJSONLDId(id)
+		attributedTo := streams.NewActivityStreamsAttributedToProperty()
+		attributedTo.AppendIRI(mustParse(testAuthorIRI))
+		note.SetActivityStreamsAttributedTo(attributedTo)
+		top := streams.NewActivityStreamsToProperty()
+		top.AppendIRI(mustParse(to))
+		note.SetActivityStreamsTo(top)
+		return note
+	}
+	followers := func() vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFollowersIRI))
+		col.SetJSONLDId(id)
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	setupFn := func(ctl *gomock.Controller, v RequestVerifier, note vocab.Type) (db *MockDatabase, h HandlerFunc) {
+		db = NewMockDatabase(ctl)
+		c := NewMockClock(ctl)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testNoteId1)),
+			db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testNoteId1)),
+		)
+		h = NewAuthorizedFetchHandler(db, c, AuthorizedFetch{
+			Verifier:        v,
+			ForbiddenStatus: http.StatusNotFound,
+		})
+		return
+	}
+	expectFollowers := func(db *MockDatabase) {
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testAuthorIRI)),
+			db.EXPECT().Owns(ctx, mustParse(testAuthorIRI)).Return(true, nil),
+			db.EXPECT().Followers(ctx, mustParse(testAuthorIRI)).Return(followers(), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testAuthorIRI)),
+		)
+	}
+	get := func(h HandlerFunc) (*httptest.ResponseRecorder, bool, error) {
+		resp := httptest.NewRecorder()
+		handled, err := h(ctx, resp, toAPRequest(httptest.NewRequest("GET", testNoteId1, nil)))
+		return resp, handled, err
+	}
+	t.Run("ServesPublicObjectsUnsigned", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, staticVerifier{err: testErr}, toNote(PublicActivityPubIRI))
+		// Run
+		resp, handled, err := get(h)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("RequiresSignature", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, staticVerifier{err: testErr}, toNote(testFollowersIRI))
+		// Run
+		resp, handled, err := get(h)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+		assertEqual(t, resp.Body.Len(), 0)
+	})
+	t.Run("ServesDirectlyAddressedSigner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, staticVerifier{signer: mustParse(testFederatedActorIRI2)}, toNote(testFederatedActorIRI2))
+		// Run
+		resp, _, err := get(h)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ServesFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, h := setupFn(ctl, staticVerifier{signer: mustParse(testFederatedActorIRI)}, toNote(testFollowersIRI))
+		expectFollowers(db)
+		// Run
+		resp, _, err := get(h)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("DeniesOthers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, h := setupFn(ctl, staticVerifier{signer: mustParse(testFederatedActorIRI2)}, toNote(testFollowersIRI))
+		expectFollowers(db)
+		// Run
+		resp, handled, err := get(h)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusNotFound)
+		assertEqual(t, resp.Body.Len(), 0)
+	})
+}
@@ -40,6 +40,12 @@ type baseActor struct {
 // baseActorFederating must satisfy the FederatingActor interface.
 var _ FederatingActor = &baseActorFederating{}
 
+// baseActorFederating must satisfy the SharedInboxActor interface.
+var _ SharedInboxActor = &baseActorFederating{}
+
+// baseActorFederating must satisfy the FollowApprovalActor interface.
+var _ FollowApprovalActor = &baseActorFederating{}
+
 // baseActorFederating is a baseActor that also satisfies the FederatingActor
 // interface.
 //
@@ -173,78 +179,143 @@ func (b *baseActor) PostInbox(c context.Context, w http.ResponseWriter, r *http.
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return true, nil
 	}
+	c, activity, ok, err := b.authenticateAndParseInbox(c, w, r)
+	if err != nil {
+		return true, err
+	} else if !ok {
+		return true, nil
+	}
+	inboxId := requestId(r)
+	// If processing is asynchronous, durably enqueue the activity and
+	// let the peer know it has been accepted.
+	if q := b.inboxQueue(c); q != nil {
+		if err := q.Enqueue(c, inboxId, activity); err != nil {
+			return true, err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return true, nil
+	}
+	err = b.processInboxItem(c, inboxId, activity)
+	if err != nil {
+		// Special case: We know it is a bad request if the object or
+		// target properties needed to be populated, but weren't.
+		//
+		// Send the rejection to the peer.
+		if err == ErrObjectRequired || err == ErrTargetRequired {
+			w.WriteHeader(http.StatusBadRequest)
+			return true, nil
+		}
+		return true, err
+	}
+	// Request has been processed. Begin responding to the request.
+	//
+	// Simply respond with an OK status to the peer.
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
+
+// requestLimits returns the limits of requests POSTed to inboxes and outboxes,
+// which are the DefaultRequestLimits unless the delegate is a RequestLimiter.
+func (b *baseActor) requestLimits(c context.Context) RequestLimits {
+	if rl, ok := b.delegate.(RequestLimiter); ok {
+		return rl.RequestLimits(c)
+	}
+	return DefaultRequestLimits
+}
+
+// inboxQueue returns the queue to asynchronously process inbox activities
+// with, or nil if they are processed while handling the request.
+func (b *baseActor) inboxQueue(c context.Context) *InboxQueue {
+	if iq, ok := b.delegate.(InboxQueuer); ok {
+		return iq.InboxQueue(c)
+	}
+	return nil
+}
+
+// processInboxItem posts the activity to the actor's inbox, triggering its
+// side effects, and then forwards it if needed.
+func (b *baseActor) processInboxItem(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	// Post the activity to the actor's inbox and trigger side effects for
+	// that particular Activity type. It is up to the delegate to resolve
+	// the given map.
+	if err := b.delegate.PostInbox(c, inboxIRI, activity); err != nil {
+		return err
+	}
+	// Our side effects are complete, now delegate determining whether to
+	// do inbox forwarding, as well as the action to do it.
+	return b.delegate.InboxForwarding(c, inboxIRI, activity)
+}
+
+// authenticateAndParseInbox handles the steps common to every POST to an inbox:
+// authenticating the peer, parsing the activity, authorizing it, and applying
+// the InboxFilters.
+//
+// If ok is false and the error is nil, then a response has already been
+// written.
+func (b *baseActor) authenticateAndParseInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, activity Activity, ok bool, err error) {
+	// Reject oversized requests before doing any work on them.
+	limits := b.requestLimits(c)
+	if ok, err = readLimitedBody(w, r, limits); err != nil || !ok {
+		return c, nil, false, err
+	}
 	// Check the peer request is authentic.
 	c, authenticated, err := b.delegate.AuthenticatePostInbox(c, w, r)
 	if err != nil {
-		return true, err
+		return c, nil, false, err
 	} else if !authenticated {
-		return true, nil
+		return c, nil, false, nil
 	}
 	// Begin processing the request, but have not yet applied
 	// authorization (ex: blocks). Obtain the activity reject unknown
 	// activities.
 	raw, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return true, err
+		return c, nil, false, err
+	}
+	if checkJSONLimits(raw, limits) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return c, nil, false, nil
 	}
 	var m map[string]interface{}
 	if err = json.Unmarshal(raw, &m); err != nil {
-		return true, err
+		return c, nil, false, err
 	}
 	asValue, err := streams.ToType(c, m)
 	if err != nil && !streams.IsUnmatchedErr(err) {
-		return true, err
+		return c, nil, false, err
 	} else if streams.IsUnmatchedErr(err) {
 		// Respond with bad request -- we do not understand the type.
 		w.WriteHeader(http.StatusBadRequest)
-		return true, nil
+		return c, nil, false, nil
 	}
-	activity, ok := asValue.(Activity)
+	activity, ok = asValue.(Activity)
 	if !ok {
-		return true, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
+		return c, nil, false, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
 	}
 	if activity.GetJSONLDId() == nil {
 		w.WriteHeader(http.StatusBadRequest)
-		return true, nil
+		return c, nil, false, nil
 	}
 	// Allow server implementations to set context data with a hook.
 	c, err = b.delegate.PostInboxRequestBodyHook(c, r, activity)
 	if err != nil {
-		return true, err
+		return c, nil, false, err
 	}
 	// Check authorization of the activity.
 	authorized, err := b.delegate.AuthorizePostInbox(c, w, activity)
 	if err != nil {
-		return true, err
+		return c, nil, false, err
 	} else if !authorized {
-		return true, nil
+		return c, nil, false, nil
 	}
-	// Post the activity to the actor's inbox and trigger side effects for
-	// that particular Activity type. It is up to the delegate to resolve
-	// the given map.
-	inboxId := requestId(r)
-	err = b.delegate.PostInbox(c, inboxId, activity)
-	if err != nil {
-		// Special case: We know it is a bad request if the object or
-		// target properties needed to be populated, but weren't.
-		//
-		// Send the rejection to the peer.
-		if err == ErrObjectRequired || err == ErrTargetRequired {
-			w.WriteHeader(http.StatusBadRequest)
-			return true, nil
+	// Inspect and rewrite the activity before any side effects occur.
+	if f, isFilterer := b.delegate.(InboxFilterer); isFilterer {
+		activity, ok, err = applyInboxFilters(c, w, f.InboxFilters(c), requestId(r), activity)
+		if err != nil || !ok {
+			return c, nil, false, err
 		}
-		return true, err
 	}
-	// Our side effects are complete, now delegate determining whether to
-	// do inbox forwarding, as well as the action to do it.
-	if err := b.delegate.InboxForwarding(c, inboxId, activity); err != nil {
-		return true, err
-	}
-	// Request has been processed. Begin responding to the request.
-	//
-	// Simply respond with an OK status to the peer.
-	w.WriteHeader(http.StatusOK)
-	return true, nil
+	return c, activity, true, nil
 }
 
 // GetInbox implements the generic algorithm for handling a GET request to an
@@ -263,14 +334,24 @@ func (b *baseActor) GetInbox(c context.Context, w http.ResponseWriter, r *http.R
 		return true, nil
 	}
 	// Everything is good to begin processing the request.
-	oc, err := b.delegate.GetInbox(c, r)
+	var oc vocab.Type
+	err = ErrNotPaged
+	if pager, ok := b.delegate.(PagingDelegateActor); ok {
+		oc, err = pagedCollection(c, r, pager.GetInboxPage)
+	}
+	if err == ErrNotPaged {
+		// Fall back to the single page given by the application.
+		oc, err = b.delegate.GetInbox(c, r)
+	}
 	if err != nil {
 		return true, err
 	}
 	// Deduplicate the 'orderedItems' property by ID.
-	err = dedupeOrderedItems(oc)
-	if err != nil {
-		return true, err
+	if oi, ok := oc.(orderedItemser); ok {
+		err = dedupeOrderedItems(oi)
+		if err != nil {
+			return true, err
+		}
 	}
 	// Request has been processed. Begin responding to the request.
 	//
@@ -283,8 +364,13 @@ func (b *baseActor) GetInbox(c context.Context, w http.ResponseWriter, r *http.R
 	if err != nil {
 		return true, err
 	}
-	// Write the response.
+	// Write the response, unless the requester has it already.
 	addResponseHeaders(w.Header(), b.clock, raw)
+	addCachingHeaders(c, w.Header(), b.delegate, oc, raw)
+	if isNotModified(r, w.Header()) {
+		w.WriteHeader(http.StatusNotModified)
+		return true, nil
+	}
 	w.WriteHeader(http.StatusOK)
 	n, err := w.Write(raw)
 	if err != nil {
@@ -308,6 +394,13 @@ func (b *baseActor) PostOutbox(c context.Context, w http.ResponseWriter, r *http
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return true, nil
 	}
+	// Reject oversized requests before doing any work on them.
+	limits := b.requestLimits(c)
+	if ok, err := readLimitedBody(w, r, limits); err != nil {
+		return true, err
+	} else if !ok {
+		return true, nil
+	}
 	// Delegate authenticating and authorizing the request.
 	c, authenticated, err := b.delegate.AuthenticatePostOutbox(c, w, r)
 	if err != nil {
@@ -320,6 +413,10 @@ func (b *baseActor) PostOutbox(c context.Context, w http.ResponseWriter, r *http
 	if err != nil {
 		return true, err
 	}
+	if checkJSONLimits(raw, limits) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return true, nil
+	}
 	var m map[string]interface{}
 	if err = json.Unmarshal(raw, &m); err != nil {
 		return true, err
@@ -377,7 +474,15 @@ func (b *baseActor) GetOutbox(c context.Context, w http.ResponseWriter, r *http.
 		return true, nil
 	}
 	// Everything is good to begin processing the request.
-	oc, err := b.delegate.GetOutbox(c, r)
+	var oc vocab.Type
+	err = ErrNotPaged
+	if pager, ok := b.delegate.(PagingDelegateActor); ok {
+		oc, err = pagedCollection(c, r, pager.GetOutboxPage)
+	}
+	if err == ErrNotPaged {
+		// Fall back to the single page given by the application.
+		oc, err = b.delegate.GetOutbox(c, r)
+	}
 	if err != nil {
 		return true, err
 	}
@@ -392,8 +497,13 @@ func (b *baseActor) GetOutbox(c context.Context, w http.ResponseWriter, r *http.
 	if err != nil {
 		return true, err
 	}
-	// Write the response.
+	// Write the response, unless the requester has it already.
 	addResponseHeaders(w.Header(), b.clock, raw)
+	addCachingHeaders(c, w.Header(), b.delegate, oc, raw)
+	if isNotModified(r, w.Header()) {
+		w.WriteHeader(http.StatusNotModified)
+		return true, nil
+	}
 	w.WriteHeader(http.StatusOK)
 	n, err := w.Write(raw)
 	if err != nil {
@@ -404,6 +514,27 @@ func (b *baseActor) GetOutbox(c context.Context, w http.ResponseWriter, r *http.
 	return true, nil
 }
 
+// pagedCollection obtains the top-level OrderedCollection or the requested
+// page of it from the application. Returns ErrNotPaged if the application does
+// not page the collection.
+func pagedCollection(c context.Context, r *http.Request, getPage func(context.Context, *http.Request, PageRequest) (vocab.ActivityStreamsOrderedCollectionPage, int, error)) (vocab.Type, error) {
+	pr := ParsePageRequest(r)
+	p, totalItems, err := getPage(c, r, pr)
+	if err != nil {
+		return nil, err
+	}
+	collection := collectionIRI(r)
+	if !pr.Page {
+		return toTopLevelCollection(collection, totalItems), nil
+	} else if p == nil {
+		return nil, fmt.Errorf("no page returned for %s", pageIRI(collection, pr))
+	}
+	if err = setPageLinks(p, collection, pr); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // deliver delegates all outbox handling steps and optionally will federate the
 // activity if the federated protocol is enabled.
 //
@@ -468,3 +599,121 @@ func (b *baseActor) deliver(c context.Context, outbox *url.URL, asValue vocab.Ty
 func (b *baseActorFederating) Send(c context.Context, outbox *url.URL, t vocab.Type) (Activity, error) {
 	return b.deliver(c, outbox, t, nil)
 }
+
+// PostSharedInbox implements the generic algorithm for handling a POST request
+// to a server's shared inbox independent on an application. It relies on a
+// delegate implementing SharedInboxDelegateActor to determine the local
+// recipients.
+func (b *baseActorFederating) PostSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	// Do nothing if it is not an ActivityPub POST request.
+	if !isActivityPubPost(r) {
+		return false, nil
+	}
+	// If the Federated Protocol is not enabled, or the delegate does not
+	// support it, then this endpoint is not enabled.
+	shared, ok := b.delegate.(SharedInboxDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true, nil
+	}
+	c, activity, ok, err := b.authenticateAndParseInbox(c, w, r)
+	if err != nil {
+		return true, err
+	} else if !ok {
+		return true, nil
+	}
+	// Determine the local actors this activity is for, once.
+	inboxes, err := shared.SharedInboxRecipients(c, activity)
+	if err != nil {
+		return true, err
+	}
+	// If processing is asynchronous, durably enqueue the activity and
+	// let the peer know it has been accepted.
+	if q := b.inboxQueue(c); q != nil {
+		if len(inboxes) > 0 {
+			if err := q.EnqueueShared(c, requestId(r), inboxes, activity); err != nil {
+				return true, err
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return true, nil
+	}
+	err = b.processSharedInboxItem(c, inboxes, activity)
+	if err != nil {
+		// Special case: We know it is a bad request if the object or
+		// target properties needed to be populated, but weren't.
+		//
+		// Send the rejection to the peer.
+		if err == ErrObjectRequired || err == ErrTargetRequired {
+			w.WriteHeader(http.StatusBadRequest)
+			return true, nil
+		}
+		return true, err
+	}
+	// Request has been processed. Begin responding to the request.
+	//
+	// Simply respond with an OK status to the peer.
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
+
+// processSharedInboxItem posts the activity received in the shared inbox to
+// the inboxes of its local recipients, triggering its side effects, and then
+// forwards it if needed.
+func (b *baseActorFederating) processSharedInboxItem(c context.Context, inboxes []*url.URL, activity Activity) error {
+	if len(inboxes) == 0 {
+		return nil
+	}
+	shared, ok := b.delegate.(SharedInboxDelegateActor)
+	if !ok {
+		return fmt.Errorf("delegate of type %T does not support the shared inbox", b.delegate)
+	}
+	// Post the activity to every recipient's inbox, triggering the side
+	// effects for that particular Activity type.
+	if err := shared.PostSharedInbox(c, inboxes, activity); err != nil {
+		return err
+	}
+	// Inbox forwarding only needs to be determined once, on behalf of the
+	// first recipient.
+	return b.delegate.InboxForwarding(c, inboxes[0], activity)
+}
+
+// followApproval returns the delegate's FollowApprovalDelegateActor, if the
+// federated protocol is enabled and the delegate implements it.
+func (b *baseActorFederating) followApproval() (FollowApprovalDelegateActor, error) {
+	f, ok := b.delegate.(FollowApprovalDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, fmt.Errorf("follow approval is not supported by this actor")
+	}
+	return f, nil
+}
+
+// PendingFollows is programmatically accessible if the federated protocol is
+// enabled.
+func (b *baseActorFederating) PendingFollows(c context.Context, inboxIRI *url.URL) ([]vocab.ActivityStreamsFollow, error) {
+	f, err := b.followApproval()
+	if err != nil {
+		return nil, err
+	}
+	return f.PendingFollows(c, inboxIRI)
+}
+
+// AcceptFollow is programmatically accessible if the federated protocol is
+// enabled.
+func (b *baseActorFederating) AcceptFollow(c context.Context, inboxIRI, followIRI *url.URL) error {
+	f, err := b.followApproval()
+	if err != nil {
+		return err
+	}
+	return f.AcceptFollow(c, inboxIRI, followIRI)
+}
+
+// RejectFollow is programmatically accessible if the federated protocol is
+// enabled.
+func (b *baseActorFederating) RejectFollow(c context.Context, inboxIRI, followIRI *url.URL) error {
+	f, err := b.followApproval()
+	if err != nil {
+		return err
+	}
+	return f.RejectFollow(c, inboxIRI, followIRI)
+}
@@ -743,3 +743,67 @@ func TestBaseActor(t *testing.T) {
 		assertEqual(t, respV.Header.Get(locationHeader), testNewActivityIRI)
 	})
 }
+
+// sharedInboxDelegateActor is a DelegateActor supporting the shared inbox.
+type sharedInboxDelegateActor struct {
+	*MockDelegateActor
+	inboxes []*url.URL
+	posted  []*url.URL
+}
+
+func (s *sharedInboxDelegateActor) SharedInboxRecipients(c context.Context, activity Activity) ([]*url.URL, error) {
+	return s.inboxes, nil
+}
+
+func (s *sharedInboxDelegateActor) PostSharedInbox(c context.Context, inboxes []*url.URL, activity Activity) error {
+	s.posted = inboxes
+	return nil
+}
+
+// TestBaseActorSharedInbox tests the shared inbox of the FederatingActor
+// returned with NewCustomActor.
+func TestBaseActorSharedInbox(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	t.Run("MethodNotAllowedIfDelegateUnsupported", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		a := NewCustomActor(NewMockDelegateActor(ctl), false, true, NewMockClock(ctl)).(SharedInboxActor)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusMethodNotAllowed)
+	})
+	t.Run("PostsOnceToAllRecipients", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate := &sharedInboxDelegateActor{
+			MockDelegateActor: NewMockDelegateActor(ctl),
+			inboxes: []*url.URL{
+				mustParse(testMyInboxIRI),
+				mustParse(testFederatedActorIRI),
+			},
+		}
+		a := NewCustomActor(delegate, false, true, NewMockClock(ctl)).(SharedInboxActor)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testListen))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testListen)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testListen)).Return(true, nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testListen)).Return(nil)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, len(delegate.posted), 2)
+	})
+}
@@ -0,0 +1,89 @@
+package pub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CachePolicer is optionally implemented by a Database, a CommonBehavior, or a
+// DelegateActor in order to set the Cache-Control header of the
+// ActivityStreams values served by the library.
+//
+// The Database's CachePolicer is used by NewActivityStreamsHandler and
+// NewAuthorizedFetchHandler. The DelegateActor's is used by GetInbox and
+// GetOutbox, for which the one created by NewActor, NewSocialActor, or
+// NewFederatingActor defers to the CommonBehavior's, or else the Database's.
+type CachePolicer interface {
+	// CacheControl returns the Cache-Control header to serve the value
+	// with, such as "max-age=300" or "private, no-cache". An empty string
+	// omits the header.
+	CacheControl(c context.Context, t vocab.Type) string
+}
+
+// toETag returns the strong entity tag of the response body.
+func toETag(responseContent []byte) string {
+	hashed := sha256.Sum256(responseContent)
+	return `"` + base64.RawURLEncoding.EncodeToString(hashed[:]) + `"`
+}
+
+// lastModified returns the 'updated' time of the value, or else its
+// 'published' time. The boolean is false if the value has neither, in which
+// case only the ETag validates it.
+func lastModified(t vocab.Type) (time.Time, bool) {
+	if v, ok := t.(updateder); ok {
+		if u := v.GetActivityStreamsUpdated(); u != nil && u.IsXMLSchemaDateTime() {
+			return u.Get(), true
+		}
+	}
+	if v, ok := t.(publisheder); ok {
+		if p := v.GetActivityStreamsPublished(); p != nil && p.IsXMLSchemaDateTime() {
+			return p.Get(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// addCachingHeaders sets the ETag, Last-Modified, and Cache-Control headers of
+// the response serving the value. The policer and value may be nil.
+func addCachingHeaders(c context.Context, h http.Header, policer interface{}, t vocab.Type, responseContent []byte) {
+	h.Set(etagHeader, toETag(responseContent))
+	if lm, ok := lastModified(t); ok {
+		h.Set(lastModifiedHeader, lm.UTC().Format(http.TimeFormat))
+	}
+	if cp, ok := policer.(CachePolicer); ok && t != nil {
+		if cc := cp.CacheControl(c, t); len(cc) > 0 {
+			h.Set(cacheControlHeader, cc)
+		}
+	}
+}
+
+// isNotModified determines whether the conditional request can be answered
+// with http.StatusNotModified given the ETag and Last-Modified headers of the
+// response, per RFC 7232 §6.
+func isNotModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get(ifNoneMatchHeader); len(inm) > 0 {
+		etag := h.Get(etagHeader)
+		for _, tag := range splitHeaderList(inm, ',') {
+			// If-None-Match uses the weak comparison function.
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		// If-Modified-Since is ignored when If-None-Match is present.
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get(ifModifiedSinceHeader))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get(lastModifiedHeader))
+	if err != nil {
+		return false
+	}
+	return !lm.After(ims)
+}
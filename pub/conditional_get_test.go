@@ -0,0 +1,151 @@
+package pub
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cachePolicingDatabase is a Database that sets a Cache-Control policy.
+type cachePolicingDatabase struct {
+	*MockDatabase
+}
+
+func (cachePolicingDatabase) CacheControl(c context.Context, t vocab.Type) string {
+	return "max-age=300"
+}
+
+// TestConditionalGet tests the caching headers and conditional requests of
+// NewActivityStreamsHandler.
+func TestConditionalGet(t *testing.T) {
+	ctx := context.Background()
+	published := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	toNote := func(isUpdated bool) vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		note.SetJSONLDId(id)
+		p := streams.NewActivityStreamsPublishedProperty()
+		p.Set(published)
+		note.SetActivityStreamsPublished(p)
+		if isUpdated {
+			u := streams.NewActivityStreamsUpdatedProperty()
+			u.Set(updated)
+			note.SetActivityStreamsUpdated(u)
+		}
+		return note
+	}
+	setupNoteFn := func(ctl *gomock.Controller, note vocab.ActivityStreamsNote) (h HandlerFunc) {
+		db := NewMockDatabase(ctl)
+		c := NewMockClock(ctl)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testNoteId1)),
+			db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testNoteId1)),
+		)
+		return NewActivityStreamsHandler(cachePolicingDatabase{db}, c)
+	}
+	setupFn := func(ctl *gomock.Controller) (h HandlerFunc) {
+		return setupNoteFn(ctl, toNote(true))
+	}
+	get := func(h HandlerFunc, header, value string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		if len(header) > 0 {
+			req.Header.Set(header, value)
+		}
+		if _, err := h(ctx, resp, req); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	t.Run("SetsCachingHeaders", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h := setupFn(ctl)
+		// Run
+		resp := get(h, "", "")
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Header().Get(etagHeader), toETag(resp.Body.Bytes()))
+		assertEqual(t, resp.Header().Get(lastModifiedHeader), "Tue, 01 Jan 2019 12:00:00 GMT")
+		assertEqual(t, resp.Header().Get(cacheControlHeader), "max-age=300")
+	})
+	t.Run("UsesPublishedWithoutUpdated", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h := setupNoteFn(ctl, toNote(false))
+		// Run
+		resp := get(h, "", "")
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Header().Get(etagHeader), toETag(resp.Body.Bytes()))
+		assertEqual(t, resp.Header().Get(lastModifiedHeader), "Mon, 01 Jan 2018 12:00:00 GMT")
+	})
+	t.Run("OmitsLastModifiedWithoutDates", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		note := toNote(false)
+		note.SetActivityStreamsPublished(nil)
+		h := setupNoteFn(ctl, note)
+		// Run
+		resp := get(h, "", "")
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Header().Get(etagHeader), toETag(resp.Body.Bytes()))
+		assertEqual(t, resp.Header().Get(lastModifiedHeader), "")
+	})
+	t.Run("NotModifiedForMatchingETag", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		etag := get(setupFn(ctl), "", "").Header().Get(etagHeader)
+		h := setupFn(ctl)
+		// Run
+		resp := get(h, ifNoneMatchHeader, `"other", W/`+etag)
+		// Verify
+		assertEqual(t, resp.Code, http.StatusNotModified)
+		assertEqual(t, resp.Body.Len(), 0)
+		assertEqual(t, resp.Header().Get(etagHeader), etag)
+	})
+	t.Run("ModifiedForOtherETag", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h := setupFn(ctl)
+		// Run
+		resp := get(h, ifNoneMatchHeader, `"other"`)
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("NotModifiedSince", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h := setupFn(ctl)
+		// Run
+		resp := get(h, ifModifiedSinceHeader, "Tue, 01 Jan 2019 12:00:00 GMT")
+		// Verify
+		assertEqual(t, resp.Code, http.StatusNotModified)
+	})
+	t.Run("ModifiedSince", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h := setupFn(ctl)
+		// Run
+		resp := get(h, ifModifiedSinceHeader, "Tue, 01 Jan 2019 11:59:59 GMT")
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+}
@@ -137,3 +137,85 @@ type Database interface {
 	// The library makes this call only after acquiring a lock first.
 	Liked(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error)
 }
+
+// LocalFollowersDatabase is optionally implemented by a Database in order to
+// deliver activities received at a shared inbox to the local actors following
+// the sender.
+type LocalFollowersDatabase interface {
+	// LocalFollowers returns the ids of the actors on this server that
+	// follow the actor with the given id.
+	//
+	// The library makes this call only after acquiring a lock first.
+	LocalFollowers(c context.Context, actorIRI *url.URL) (followers []*url.URL, err error)
+}
+
+// AppendCollectionDatabase is optionally implemented by a Database in order to
+// store inboxes and outboxes as append-only collections, instead of having the
+// library read, prepend to, and write back their first page.
+//
+// When implemented, the library no longer calls GetInbox, SetInbox,
+// GetOutbox, or SetOutbox. Deciding how items are split into pages is left to
+// the implementation.
+type AppendCollectionDatabase interface {
+	// AppendInbox adds the id as the newest item of the inbox. The item
+	// must not be added as an independent database entry.
+	//
+	// The library calls InboxContains first, and makes this call only
+	// after acquiring a lock first.
+	AppendInbox(c context.Context, inboxIRI, id *url.URL) error
+	// AppendOutbox adds the id as the newest item of the outbox. The item
+	// must not be added as an independent database entry.
+	//
+	// The library makes this call only after acquiring a lock first.
+	AppendOutbox(c context.Context, outboxIRI, id *url.URL) error
+	// InboxItems returns the ids of the items on the requested page of
+	// the inbox, newest first, along with the total number of items in
+	// the inbox.
+	//
+	// The library makes this call only after acquiring a lock first.
+	InboxItems(c context.Context, inboxIRI *url.URL, page PageRequest) (items []*url.URL, totalItems int, err error)
+	// OutboxItems returns the ids of the items on the requested page of
+	// the outbox, newest first, along with the total number of items in
+	// the outbox.
+	//
+	// The library makes this call only after acquiring a lock first.
+	OutboxItems(c context.Context, outboxIRI *url.URL, page PageRequest) (items []*url.URL, totalItems int, err error)
+}
+
+// TxDatabase is optionally implemented by a Database in order to apply all of
+// the side effects of an activity atomically.
+//
+// The transaction is carried in the context returned by Begin, and every
+// Database call made with that context, including Lock and Unlock, is part of
+// the transaction. Deliveries made while handling the activity are only
+// attempted or enqueued once the transaction commits.
+type TxDatabase interface {
+	// Begin starts a transaction, returning a context carrying it.
+	Begin(c context.Context) (tx context.Context, err error)
+	// Commit applies the changes made in the transaction.
+	Commit(tx context.Context) error
+	// Rollback discards the changes made in the transaction.
+	Rollback(tx context.Context) error
+}
+
+// PendingFollowsDatabase is optionally implemented by a Database in order to
+// keep Follow requests awaiting approval, such as for locked accounts using
+// OnFollowQueueForApproval.
+type PendingFollowsDatabase interface {
+	// AddPendingFollow records the Follow of the local actor as awaiting
+	// approval.
+	//
+	// The library makes this call only after acquiring a lock first.
+	AddPendingFollow(c context.Context, actorIRI *url.URL, follow vocab.ActivityStreamsFollow) error
+	// PendingFollows returns the Follows of the local actor awaiting
+	// approval, oldest first.
+	//
+	// The library makes this call only after acquiring a lock first.
+	PendingFollows(c context.Context, actorIRI *url.URL) (follows []vocab.ActivityStreamsFollow, err error)
+	// RemovePendingFollow removes the Follow with the id from those of the
+	// local actor awaiting approval, and returns it. Returns nil if there
+	// is no such pending Follow.
+	//
+	// The library makes this call only after acquiring a lock first.
+	RemovePendingFollow(c context.Context, actorIRI, followIRI *url.URL) (follow vocab.ActivityStreamsFollow, err error)
+}
@@ -33,7 +33,8 @@ type DelegateActor interface {
 	//
 	// Warning: Neither authentication nor authorization has taken place at
 	// this time. Doing anything beyond setting contextual information is
-	// strongly discouraged.
+	// strongly discouraged. To reject or rewrite activities once they are
+	// authorized, implement InboxFilterer instead.
 	//
 	// If an error is returned, it is passed back to the caller of
 	// PostInbox. In this case, the DelegateActor implementation must not
@@ -246,3 +247,48 @@ type DelegateActor interface {
 	// API is enabled.
 	GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
 }
+
+// SharedInboxDelegateActor is optionally implemented by a DelegateActor in order
+// to receive activities at a server's shared inbox.
+//
+// Note that an implementation of this interface is implicitly provided in the
+// calls to NewActor and NewFederatingActor.
+type SharedInboxDelegateActor interface {
+	// SharedInboxRecipients returns the inbox IRIs of the actors on this
+	// server that an activity received at the shared inbox is addressed
+	// to, either directly or through a collection such as the sender's
+	// followers.
+	//
+	// Only called if the Federated Protocol is enabled.
+	SharedInboxRecipients(c context.Context, activity Activity) (inboxes []*url.URL, err error)
+	// PostSharedInbox adds the activity to each of the inboxes, and
+	// triggers the side effects of the activity. Side effects storing the
+	// activity's data occur only once, while those applying to the actor
+	// owning an inbox, such as accepting a Follow, occur for every inbox.
+	//
+	// Only called if the Federated Protocol is enabled.
+	//
+	// If an error is returned, it is passed back to the caller of
+	// PostSharedInbox. Returning ErrObjectRequired or ErrTargetRequired
+	// results in a http.StatusBadRequest response.
+	PostSharedInbox(c context.Context, inboxes []*url.URL, activity Activity) error
+}
+
+// FollowApprovalDelegateActor is optionally implemented by a DelegateActor in
+// order to approve or deny Follow requests queued with
+// OnFollowQueueForApproval.
+//
+// Note that an implementation of this interface is implicitly provided in the
+// calls to NewActor and NewFederatingActor.
+type FollowApprovalDelegateActor interface {
+	// PendingFollows returns the Follow requests awaiting approval by the
+	// actor owning the inbox.
+	PendingFollows(c context.Context, inboxIRI *url.URL) (follows []vocab.ActivityStreamsFollow, err error)
+	// AcceptFollow accepts the pending Follow request with the id, adding
+	// its actors to the followers of the actor owning the inbox and
+	// delivering an Accept to them.
+	AcceptFollow(c context.Context, inboxIRI, followIRI *url.URL) error
+	// RejectFollow rejects the pending Follow request with the id,
+	// delivering a Reject to its actors.
+	RejectFollow(c context.Context, inboxIRI, followIRI *url.URL) error
+}
@@ -0,0 +1,381 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Delivery is a single activity that is to be sent to a single recipient
+// inbox on behalf of a local actor.
+type Delivery struct {
+	// Id uniquely identifies this Delivery within a DeliveryStore. It is
+	// assigned by the DeliveryStore when enqueued.
+	Id string
+	// BoxIRI is the inbox or outbox of the local actor sending the
+	// activity. It is used to obtain a Transport with the actor's
+	// credentials.
+	BoxIRI *url.URL
+	// Recipient is the inbox IRI the payload is delivered to.
+	Recipient *url.URL
+	// Payload is the serialized activity.
+	Payload []byte
+	// Created is when the delivery was first enqueued.
+	Created time.Time
+	// Attempts is the number of delivery attempts made so far.
+	Attempts int
+	// NextAttempt is the earliest time the next attempt may be made.
+	NextAttempt time.Time
+	// LastError is the error message of the most recent failed attempt.
+	LastError string
+}
+
+// DeliveryStore durably persists pending Deliveries for a DeliveryQueue.
+//
+// A DeliveryStore is expected to be used by only one DeliveryQueue at a time,
+// which is the sole consumer of its Deliveries.
+type DeliveryStore interface {
+	// Enqueue persists a new Delivery, assigning it a unique Id.
+	Enqueue(c context.Context, d *Delivery) error
+	// Due returns at most max Deliveries whose NextAttempt is not after
+	// the given time, earliest first.
+	Due(c context.Context, now time.Time, max int) ([]*Delivery, error)
+	// Reschedule persists the Attempts, NextAttempt, and LastError of an
+	// existing Delivery.
+	Reschedule(c context.Context, d *Delivery) error
+	// Remove deletes a Delivery that has either succeeded or been given
+	// up on.
+	Remove(c context.Context, d *Delivery) error
+}
+
+// RetryPolicy determines when failed Deliveries are retried, and when they
+// are given up on.
+type RetryPolicy struct {
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two attempts.
+	MaxInterval time.Duration
+	// Multiplier grows the delay after every failed attempt.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomized so that retries to the same peer are spread out.
+	Jitter float64
+	// GiveUpAfter is the horizon after which a Delivery that has not
+	// succeeded is dropped, measured from when it was first enqueued.
+	GiveUpAfter time.Duration
+}
+
+// DefaultRetryPolicy retries for up to two days, backing off from thirty
+// seconds to at most six hours between attempts.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: 30 * time.Second,
+	MaxInterval:     6 * time.Hour,
+	Multiplier:      2,
+	Jitter:          0.2,
+	GiveUpAfter:     48 * time.Hour,
+}
+
+// backoff returns the delay before the next attempt, given the number of
+// attempts already made.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := float64(p.InitialInterval)
+	for i := 1; i < attempts; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxInterval) {
+			d = float64(p.MaxInterval)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+const (
+	// deliveryQueuePollInterval is how often the DeliveryQueue checks the
+	// DeliveryStore for Deliveries that have become due.
+	deliveryQueuePollInterval = 5 * time.Second
+	// deliveryQueueBatchSize is the maximum number of Deliveries fetched
+	// from the DeliveryStore at once.
+	deliveryQueueBatchSize = 100
+)
+
+// DeliveryQueue sends activities to peers in the background, retrying failed
+// deliveries with exponential backoff until they succeed or the RetryPolicy
+// gives up on them.
+//
+// A CommonBehavior that implements DeliveryQueuer has all of the library's
+// federated deliveries routed through its DeliveryQueue.
+type DeliveryQueue struct {
+	store        DeliveryStore
+	clock        Clock
+	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
+	policy       RetryPolicy
+	workers      int
+	// OnGiveUp, if set, is called when a Delivery is dropped after the
+	// RetryPolicy gives up on it, or after it fails permanently.
+	OnGiveUp func(c context.Context, d *Delivery)
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	startMu  sync.Mutex
+	started  bool
+}
+
+// NewDeliveryQueue creates a DeliveryQueue backed by the given store.
+//
+// The newTransport function is used to obtain a Transport for every attempt,
+// and is typically the application's CommonBehavior.NewTransport. At most
+// 'workers' attempts are made concurrently.
+//
+// Start must be called before any Deliveries are attempted.
+func NewDeliveryQueue(store DeliveryStore,
+	clock Clock,
+	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error),
+	policy RetryPolicy,
+	workers int) *DeliveryQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &DeliveryQueue{
+		store:        store,
+		clock:        clock,
+		newTransport: newTransport,
+		policy:       policy,
+		workers:      workers,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enqueue persists one Delivery of the payload per recipient, to be sent on
+// behalf of the actor owning the boxIRI.
+func (q *DeliveryQueue) Enqueue(c context.Context, boxIRI *url.URL, payload []byte, recipients []*url.URL) error {
+	now := q.clock.Now()
+	for _, r := range recipients {
+		d := &Delivery{
+			BoxIRI:      boxIRI,
+			Recipient:   r,
+			Payload:     payload,
+			Created:     now,
+			NextAttempt: now,
+		}
+		if err := q.store.Enqueue(c, d); err != nil {
+			return err
+		}
+	}
+	// Let the background loop know there is new work without blocking.
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start begins attempting Deliveries in the background. It is a no-op if the
+// DeliveryQueue is already started.
+func (q *DeliveryQueue) Start() {
+	q.startMu.Lock()
+	defer q.startMu.Unlock()
+	if q.started {
+		return
+	}
+	q.started = true
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go q.loop()
+}
+
+// Stop halts the background processing, waiting for in-flight attempts to
+// finish. Pending Deliveries remain in the DeliveryStore.
+func (q *DeliveryQueue) Stop() {
+	q.startMu.Lock()
+	defer q.startMu.Unlock()
+	if !q.started {
+		return
+	}
+	close(q.stop)
+	<-q.done
+	q.started = false
+}
+
+// loop processes due Deliveries until stopped.
+func (q *DeliveryQueue) loop() {
+	defer close(q.done)
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-q.stop:
+			cancel()
+		case <-c.Done():
+		}
+	}()
+	ticker := time.NewTicker(deliveryQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		q.processDue(c)
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDue attempts every Delivery that is currently due, in batches.
+func (q *DeliveryQueue) processDue(c context.Context) {
+	for c.Err() == nil {
+		due, err := q.store.Due(c, q.clock.Now(), deliveryQueueBatchSize)
+		if err != nil || len(due) == 0 {
+			return
+		}
+		sem := make(chan struct{}, q.workers)
+		var wg sync.WaitGroup
+		for _, d := range due {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(d *Delivery) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				q.attempt(c, d)
+			}(d)
+		}
+		wg.Wait()
+		if len(due) < deliveryQueueBatchSize {
+			return
+		}
+	}
+}
+
+// attempt makes a single delivery attempt, then removes or reschedules the
+// Delivery based on the outcome. A Delivery that fails permanently is given up
+// on without being retried.
+func (q *DeliveryQueue) attempt(c context.Context, d *Delivery) {
+	err := q.deliver(c, d)
+	if err == nil {
+		q.store.Remove(c, d)
+		return
+	} else if c.Err() != nil {
+		// Stopping: leave the Delivery as-is to be retried later.
+		return
+	}
+	now := q.clock.Now()
+	d.Attempts++
+	d.LastError = err.Error()
+	d.NextAttempt = now.Add(q.policy.backoff(d.Attempts))
+	permanent := false
+	if de, ok := err.(*DeliverError); ok {
+		permanent = de.Kind() == PermanentFailure
+	}
+	if permanent || now.Sub(d.Created) >= q.policy.GiveUpAfter || d.NextAttempt.Sub(d.Created) > q.policy.GiveUpAfter {
+		q.store.Remove(c, d)
+		if q.OnGiveUp != nil {
+			q.OnGiveUp(c, d)
+		}
+		return
+	}
+	q.store.Reschedule(c, d)
+}
+
+// deliver sends the payload using a Transport for the sending actor.
+func (q *DeliveryQueue) deliver(c context.Context, d *Delivery) error {
+	tp, err := q.newTransport(c, d.BoxIRI, goFedUserAgent())
+	if err != nil {
+		return err
+	}
+	return tp.Deliver(c, d.Payload, d.Recipient)
+}
+
+// DeliveryQueuer is optionally implemented by a CommonBehavior in order to
+// have Send, PostOutbox, and inbox forwarding enqueue their deliveries instead
+// of attempting them only once while handling the request.
+type DeliveryQueuer interface {
+	// DeliveryQueue returns the queue to enqueue deliveries in. Returning
+	// nil attempts deliveries inline instead.
+	DeliveryQueue(c context.Context) *DeliveryQueue
+}
+
+// DeliveryStore must be implemented by MemoryDeliveryStore.
+var _ DeliveryStore = &MemoryDeliveryStore{}
+
+// MemoryDeliveryStore is a DeliveryStore that keeps Deliveries in memory.
+//
+// It is not durable, and is meant for tests and prototypes.
+type MemoryDeliveryStore struct {
+	mu         sync.Mutex
+	nextId     uint64
+	deliveries map[string]*Delivery
+}
+
+// NewMemoryDeliveryStore creates an empty MemoryDeliveryStore.
+func NewMemoryDeliveryStore() *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{
+		deliveries: make(map[string]*Delivery),
+	}
+}
+
+// Enqueue stores a copy of the Delivery.
+func (m *MemoryDeliveryStore) Enqueue(c context.Context, d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextId++
+	d.Id = fmt.Sprintf("%d", m.nextId)
+	cp := *d
+	m.deliveries[d.Id] = &cp
+	return nil
+}
+
+// Due returns copies of the due Deliveries, earliest first.
+func (m *MemoryDeliveryStore) Due(c context.Context, now time.Time, max int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*Delivery
+	for _, d := range m.deliveries {
+		if !d.NextAttempt.After(now) {
+			cp := *d
+			due = append(due, &cp)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+	if len(due) > max {
+		due = due[:max]
+	}
+	return due, nil
+}
+
+// Reschedule updates the stored copy of the Delivery.
+func (m *MemoryDeliveryStore) Reschedule(c context.Context, d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.deliveries[d.Id]
+	if !ok {
+		return fmt.Errorf("no delivery with id %q", d.Id)
+	}
+	stored.Attempts = d.Attempts
+	stored.NextAttempt = d.NextAttempt
+	stored.LastError = d.LastError
+	return nil
+}
+
+// Remove deletes the Delivery.
+func (m *MemoryDeliveryStore) Remove(c context.Context, d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.deliveries, d.Id)
+	return nil
+}
+
+// Len returns the number of pending Deliveries.
+func (m *MemoryDeliveryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.deliveries)
+}
@@ -0,0 +1,180 @@
+package pub
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// queuingCommonBehavior is a CommonBehavior that routes deliveries through a
+// DeliveryQueue.
+type queuingCommonBehavior struct {
+	*MockCommonBehavior
+	q *DeliveryQueue
+}
+
+func (q *queuingCommonBehavior) DeliveryQueue(c context.Context) *DeliveryQueue {
+	return q.q
+}
+
+// TestDeliveryQueue tests the retrying behavior of the DeliveryQueue.
+func TestDeliveryQueue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	payload := []byte("{}")
+	policy := RetryPolicy{
+		InitialInterval: time.Minute,
+		MaxInterval:     time.Hour,
+		Multiplier:      2,
+		GiveUpAfter:     24 * time.Hour,
+	}
+	setupFn := func(ctl *gomock.Controller) (s *MemoryDeliveryStore, cl *MockClock, tp *MockTransport, q *DeliveryQueue) {
+		s = NewMemoryDeliveryStore()
+		cl = NewMockClock(ctl)
+		tp = NewMockTransport(ctl)
+		q = NewDeliveryQueue(s, cl, func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+			return tp, nil
+		}, policy, 2)
+		return
+	}
+	t.Run("RemovesSuccessfulDeliveries", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, cl, tp, q := setupFn(ctl)
+		cl.EXPECT().Now().Return(now).AnyTimes()
+		tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI)).Return(nil)
+		tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI2)).Return(nil)
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), payload, []*url.URL{
+			mustParse(testFederatedActorIRI),
+			mustParse(testFederatedActorIRI2),
+		})
+		q.processDue(ctx)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, s.Len(), 0)
+	})
+	t.Run("ReschedulesFailedDeliveriesWithBackoff", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, cl, tp, q := setupFn(ctl)
+		cl.EXPECT().Now().Return(now).AnyTimes()
+		tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI)).Return(testErr)
+		// Run
+		q.Enqueue(ctx, mustParse(testMyOutboxIRI), payload, []*url.URL{mustParse(testFederatedActorIRI)})
+		q.processDue(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 1)
+		due, _ := s.Due(ctx, now.Add(time.Minute), 10)
+		assertEqual(t, len(due), 1)
+		assertEqual(t, due[0].Attempts, 1)
+		assertEqual(t, due[0].NextAttempt, now.Add(time.Minute))
+		assertEqual(t, due[0].LastError, testErr.Error())
+	})
+	t.Run("RetriesWhenDue", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, cl, tp, q := setupFn(ctl)
+		gomock.InOrder(
+			cl.EXPECT().Now().Return(now).Times(3),
+			cl.EXPECT().Now().Return(now.Add(time.Minute)).AnyTimes(),
+		)
+		gomock.InOrder(
+			tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI)).Return(testErr),
+			tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI)).Return(nil),
+		)
+		// Run
+		q.Enqueue(ctx, mustParse(testMyOutboxIRI), payload, []*url.URL{mustParse(testFederatedActorIRI)})
+		q.processDue(ctx)
+		q.processDue(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 0)
+	})
+	t.Run("GivesUpAfterHorizon", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, cl, tp, q := setupFn(ctl)
+		var gaveUp *Delivery
+		q.OnGiveUp = func(c context.Context, d *Delivery) {
+			gaveUp = d
+		}
+		gomock.InOrder(
+			cl.EXPECT().Now().Return(now).Times(2),
+			cl.EXPECT().Now().Return(now.Add(25*time.Hour)).AnyTimes(),
+		)
+		tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI)).Return(testErr)
+		// Run
+		q.Enqueue(ctx, mustParse(testMyOutboxIRI), payload, []*url.URL{mustParse(testFederatedActorIRI)})
+		q.processDue(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 0)
+		assertEqual(t, gaveUp.Recipient.String(), testFederatedActorIRI)
+	})
+	t.Run("GivesUpOnPermanentFailures", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, cl, tp, q := setupFn(ctl)
+		var gaveUp *Delivery
+		q.OnGiveUp = func(c context.Context, d *Delivery) {
+			gaveUp = d
+		}
+		cl.EXPECT().Now().Return(now).AnyTimes()
+		tp.EXPECT().Deliver(gomock.Any(), payload, mustParse(testFederatedActorIRI)).Return(&DeliverError{
+			Recipient:  mustParse(testFederatedActorIRI),
+			StatusCode: http.StatusGone,
+		})
+		// Run
+		q.Enqueue(ctx, mustParse(testMyOutboxIRI), payload, []*url.URL{mustParse(testFederatedActorIRI)})
+		q.processDue(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 0)
+		assertEqual(t, gaveUp.Attempts, 1)
+	})
+	t.Run("SideEffectActorEnqueuesDeliveries", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		s, cl, _, q := setupFn(ctl)
+		cl.EXPECT().Now().Return(now).AnyTimes()
+		a := &sideEffectActor{
+			common: &queuingCommonBehavior{NewMockCommonBehavior(ctl), q},
+		}
+		// Run
+		err := a.deliverToRecipients(ctx, mustParse(testMyOutboxIRI), testCreate, []*url.URL{
+			mustParse(testFederatedActorIRI),
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		due, _ := s.Due(ctx, now, 10)
+		assertEqual(t, len(due), 1)
+		assertByteEqual(t, due[0].Payload, mustSerializeToBytes(testCreate))
+		assertEqual(t, due[0].BoxIRI.String(), testMyOutboxIRI)
+	})
+}
+
+// TestRetryPolicyBackoff tests the exponential backoff is capped.
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+	assertEqual(t, p.backoff(1), time.Second)
+	assertEqual(t, p.backoff(3), 4*time.Second)
+	assertEqual(t, p.backoff(10), 10*time.Second)
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if d := p.backoff(2); d < time.Second || d > 3*time.Second {
+			t.Fatalf("backoff with jitter out of range: %s", d)
+		}
+	}
+}
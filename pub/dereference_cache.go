@@ -0,0 +1,290 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheControlHeader is the Cache-Control header.
+	cacheControlHeader = "Cache-Control"
+	// etagHeader is the ETag header.
+	etagHeader = "ETag"
+	// lastModifiedHeader is the Last-Modified header.
+	lastModifiedHeader = "Last-Modified"
+	// ifNoneMatchHeader is the If-None-Match header.
+	ifNoneMatchHeader = "If-None-Match"
+	// ifModifiedSinceHeader is the If-Modified-Since header.
+	ifModifiedSinceHeader = "If-Modified-Since"
+)
+
+// CachedResponse is a response to a GET request kept in a DereferenceCache.
+type CachedResponse struct {
+	// Body is the body of the response.
+	Body []byte
+	// Header contains the headers of the response.
+	Header http.Header
+	// Expires is when the response is no longer fresh and must be
+	// revalidated. A zero value means it must always be revalidated.
+	Expires time.Time
+}
+
+// DereferenceCache stores the responses of a CachingClient.
+//
+// Responses are stored under a key which is the IRI of an unsigned request, or
+// the keyId of the HTTP Signature followed by a space and the IRI of a signed
+// request.
+//
+// Implementations may evict entries at any time.
+type DereferenceCache interface {
+	// Get returns the response cached for the key, or nil if there is
+	// none.
+	Get(c context.Context, key string) (*CachedResponse, error)
+	// Set caches the response for the key.
+	Set(c context.Context, key string, r *CachedResponse) error
+	// Delete removes any response cached for the key.
+	Delete(c context.Context, key string) error
+}
+
+// forceRefreshContextKey is the context key marking that cached responses
+// must not be used.
+type forceRefreshContextKey struct{}
+
+// WithForceRefresh returns a context that makes a CachingClient ignore cached
+// responses, such as when passed to Transport.Dereference. The fetched
+// response is still cached.
+func WithForceRefresh(c context.Context) context.Context {
+	return context.WithValue(c, forceRefreshContextKey{}, true)
+}
+
+// isForceRefresh returns true if the context requires a refresh.
+func isForceRefresh(c context.Context) bool {
+	b, _ := c.Value(forceRefreshContextKey{}).(bool)
+	return b
+}
+
+// HttpClient must be implemented by CachingClient.
+var _ HttpClient = &CachingClient{}
+
+// CachingClient is an HttpClient that caches the responses to GET requests,
+// such as those made by HttpSigTransport.Dereference. Other requests are sent
+// as-is.
+//
+// Responses are cached according to their Cache-Control header, except for
+// those marked 'private' or 'no-store'. A fresh response is used without a
+// request being made. A stale response with an ETag or Last-Modified header
+// is revalidated with a conditional request.
+//
+// Servers may respond differently depending on who signed a request, so the
+// responses to signed requests are only reused for requests signed with the
+// same keyId.
+type CachingClient struct {
+	client HttpClient
+	cache  DereferenceCache
+	clock  Clock
+}
+
+// NewCachingClient wraps the client with the given cache.
+func NewCachingClient(client HttpClient, cache DereferenceCache, clock Clock) *CachingClient {
+	return &CachingClient{
+		client: client,
+		cache:  cache,
+		clock:  clock,
+	}
+}
+
+// Do serves GET requests from the cache when possible.
+//
+// Errors from the DereferenceCache are not fatal: the request is sent as if
+// nothing were cached.
+func (cc *CachingClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return cc.client.Do(req)
+	}
+	c := req.Context()
+	key := cacheKey(req)
+	var cached *CachedResponse
+	if !isForceRefresh(c) {
+		cached, _ = cc.cache.Get(c, key)
+	}
+	if cached != nil {
+		if cc.clock.Now().Before(cached.Expires) {
+			return toCachedHttpResponse(req, cached), nil
+		}
+		if etag := cached.Header.Get(etagHeader); len(etag) > 0 {
+			req.Header.Set(ifNoneMatchHeader, etag)
+		}
+		if lm := cached.Header.Get(lastModifiedHeader); len(lm) > 0 {
+			req.Header.Set(ifModifiedSinceHeader, lm)
+		}
+	}
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		cached.Header = cloneHeader(cached.Header)
+		// RFC 7232 §4.1: the 304 response updates the stored headers.
+		for _, h := range []string{cacheControlHeader, etagHeader, lastModifiedHeader} {
+			if v := resp.Header.Get(h); len(v) > 0 {
+				cached.Header.Set(h, v)
+			}
+		}
+		cached.Expires = cc.expires(cached.Header)
+		cc.cache.Set(c, key, cached)
+		return toCachedHttpResponse(req, cached), nil
+	} else if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	directives := parseCacheControl(resp.Header.Get(cacheControlHeader))
+	_, noStore := directives["no-store"]
+	_, private := directives["private"]
+	if noStore || private {
+		cc.cache.Delete(c, key)
+		return resp, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	expires := cc.expires(resp.Header)
+	if expires.IsZero() && len(resp.Header.Get(etagHeader)) == 0 && len(resp.Header.Get(lastModifiedHeader)) == 0 {
+		// Nothing would be gained by caching the response.
+		return resp, nil
+	}
+	cc.cache.Set(c, key, &CachedResponse{
+		Body:    b,
+		Header:  cloneHeader(resp.Header),
+		Expires: expires,
+	})
+	return resp, nil
+}
+
+// cacheKey returns the key of the DereferenceCache entry for the request,
+// which distinguishes the signer of a signed request.
+func cacheKey(req *http.Request) string {
+	if keyId, ok := signatureParam(req, "keyId"); ok {
+		return keyId + " " + req.URL.String()
+	}
+	return req.URL.String()
+}
+
+// expires determines until when a response is fresh, based on the max-age
+// directive of its Cache-Control header.
+func (cc *CachingClient) expires(h http.Header) time.Time {
+	directives := parseCacheControl(h.Get(cacheControlHeader))
+	if _, noCache := directives["no-cache"]; noCache {
+		return time.Time{}
+	}
+	maxAge, ok := directives["max-age"]
+	if !ok {
+		return time.Time{}
+	}
+	secs, err := strconv.Atoi(maxAge)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return cc.clock.Now().Add(time.Duration(secs) * time.Second)
+}
+
+// toCachedHttpResponse creates a response to the request from the cache.
+func toCachedHttpResponse(req *http.Request, cached *CachedResponse) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cached.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       req,
+	}
+}
+
+// parseCacheControl parses the directives of a Cache-Control header into a
+// map of lowercased directive names to their, possibly empty, values.
+func parseCacheControl(v string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range strings.Split(v, ",") {
+		d = strings.TrimSpace(d)
+		if len(d) == 0 {
+			continue
+		}
+		kv := strings.SplitN(d, "=", 2)
+		k := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			directives[k] = strings.Trim(strings.TrimSpace(kv[1]), "\"")
+		} else {
+			directives[k] = ""
+		}
+	}
+	return directives
+}
+
+// cloneHeader deeply copies the header, returning an empty header for nil.
+func cloneHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// DereferenceCache must be implemented by MemoryDereferenceCache.
+var _ DereferenceCache = &MemoryDereferenceCache{}
+
+// MemoryDereferenceCache is a DereferenceCache that keeps responses in memory.
+//
+// It never evicts entries, and is meant for tests and prototypes.
+type MemoryDereferenceCache struct {
+	mu        sync.Mutex
+	responses map[string]*CachedResponse
+}
+
+// NewMemoryDereferenceCache creates an empty MemoryDereferenceCache.
+func NewMemoryDereferenceCache() *MemoryDereferenceCache {
+	return &MemoryDereferenceCache{
+		responses: make(map[string]*CachedResponse),
+	}
+}
+
+// Get returns a copy of the cached response.
+func (m *MemoryDereferenceCache) Get(c context.Context, key string) (*CachedResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	cp := *r
+	cp.Header = cloneHeader(r.Header)
+	return &cp, nil
+}
+
+// Set stores a copy of the response.
+func (m *MemoryDereferenceCache) Set(c context.Context, key string, r *CachedResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *r
+	cp.Header = cloneHeader(r.Header)
+	m.responses[key] = &cp
+	return nil
+}
+
+// Delete removes the cached response.
+func (m *MemoryDereferenceCache) Delete(c context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.responses, key)
+	return nil
+}
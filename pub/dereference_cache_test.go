@@ -0,0 +1,166 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// scriptedClient is an HttpClient returning its responses in order, and
+// recording the requests.
+type scriptedClient struct {
+	responses []*http.Response
+	requests  []*http.Request
+}
+
+func (s *scriptedClient) Do(req *http.Request) (*http.Response, error) {
+	s.requests = append(s.requests, req)
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+// toHeader creates a header with a single value.
+func toHeader(k, v string) http.Header {
+	h := http.Header{}
+	h.Set(k, v)
+	return h
+}
+
+// toResponse creates a response with the status, headers, and body.
+func toResponse(code int, h http.Header, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Header:     h,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+	}
+}
+
+// TestCachingClient tests caching dereferenced responses.
+func TestCachingClient(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	setupFn := func(ctl *gomock.Controller, responses ...*http.Response) (sc *scriptedClient, cl *MockClock, cc *CachingClient) {
+		sc = &scriptedClient{responses: responses}
+		cl = NewMockClock(ctl)
+		cc = NewCachingClient(sc, NewMemoryDereferenceCache(), cl)
+		return
+	}
+	signedGetFn := func(c context.Context, cc *CachingClient, keyId string) (int, string) {
+		req, _ := http.NewRequest("GET", testFederatedActorIRI, nil)
+		if len(keyId) > 0 {
+			req.Header.Set(signatureHeader, `keyId="`+keyId+`",algorithm="rsa-sha256",headers="(request-target) date",signature="x"`)
+		}
+		resp, err := cc.Do(req.WithContext(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	getFn := func(c context.Context, cc *CachingClient) (int, string) {
+		return signedGetFn(c, cc, "")
+	}
+	t.Run("ServesFreshResponsesFromCache", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sc, cl, cc := setupFn(ctl,
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "max-age=60"), "actor"))
+		gomock.InOrder(
+			cl.EXPECT().Now().Return(start),
+			cl.EXPECT().Now().Return(start.Add(30*time.Second)),
+		)
+		// Run
+		getFn(ctx, cc)
+		code, body := getFn(ctx, cc)
+		// Verify
+		assertEqual(t, len(sc.requests), 1)
+		assertEqual(t, code, http.StatusOK)
+		assertEqual(t, body, "actor")
+	})
+	t.Run("RevalidatesStaleResponses", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sc, cl, cc := setupFn(ctl,
+			toResponse(http.StatusOK, toHeader(etagHeader, `"v1"`), "actor"),
+			toResponse(http.StatusNotModified, http.Header{}, ""))
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		// Run
+		getFn(ctx, cc)
+		code, body := getFn(ctx, cc)
+		// Verify
+		assertEqual(t, len(sc.requests), 2)
+		assertEqual(t, sc.requests[1].Header.Get(ifNoneMatchHeader), `"v1"`)
+		assertEqual(t, code, http.StatusOK)
+		assertEqual(t, body, "actor")
+	})
+	t.Run("ForcesRefresh", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sc, cl, cc := setupFn(ctl,
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "max-age=60"), "old"),
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "max-age=60"), "new"))
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		// Run
+		getFn(ctx, cc)
+		_, body := getFn(WithForceRefresh(ctx), cc)
+		// Verify
+		assertEqual(t, len(sc.requests), 2)
+		assertEqual(t, sc.requests[1].Header.Get(ifNoneMatchHeader), "")
+		assertEqual(t, body, "new")
+	})
+	t.Run("DoesNotStoreNoStore", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sc, cl, cc := setupFn(ctl,
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "no-store, max-age=60"), "actor"),
+			toResponse(http.StatusOK, http.Header{}, "actor"))
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		// Run
+		getFn(ctx, cc)
+		getFn(ctx, cc)
+		// Verify
+		assertEqual(t, len(sc.requests), 2)
+	})
+	t.Run("DoesNotStorePrivate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sc, cl, cc := setupFn(ctl,
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "private, max-age=60"), "actor"),
+			toResponse(http.StatusOK, http.Header{}, "actor"))
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		// Run
+		getFn(ctx, cc)
+		getFn(ctx, cc)
+		// Verify
+		assertEqual(t, len(sc.requests), 2)
+	})
+	t.Run("SeparatesSigners", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sc, cl, cc := setupFn(ctl,
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "max-age=60"), "for alice"),
+			toResponse(http.StatusOK, toHeader(cacheControlHeader, "max-age=60"), "for bob"))
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		// Run
+		_, alice := signedGetFn(ctx, cc, testFederatedActorIRI3+"#main-key")
+		_, bob := signedGetFn(ctx, cc, testFederatedActorIRI2+"#main-key")
+		_, aliceAgain := signedGetFn(ctx, cc, testFederatedActorIRI3+"#main-key")
+		// Verify
+		assertEqual(t, len(sc.requests), 2)
+		assertEqual(t, alice, "for alice")
+		assertEqual(t, bob, "for bob")
+		assertEqual(t, aliceAgain, "for alice")
+	})
+}
@@ -26,7 +26,8 @@ type FederatingProtocol interface {
 	//
 	// Warning: Neither authentication nor authorization has taken place at
 	// this time. Doing anything beyond setting contextual information is
-	// strongly discouraged.
+	// strongly discouraged. To reject or rewrite activities once they are
+	// authorized, implement InboxFilterer instead.
 	//
 	// If an error is returned, it is passed back to the caller of
 	// PostInbox. In this case, the DelegateActor implementation must not
@@ -49,6 +50,9 @@ type FederatingProtocol interface {
 	// Finally, if the authentication and authorization succeeds, then
 	// authenticated must be true and error nil. The request will continue
 	// to be processed.
+	//
+	// HttpSigVerifier provides an implementation that verifies HTTP
+	// Signatures.
 	AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error)
 	// Blocked should determine whether to permit a set of actors given by
 	// their ids are able to interact with this particular end user due to
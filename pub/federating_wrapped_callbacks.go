@@ -23,6 +23,11 @@ const (
 	// OnFollowAutomaticallyAccept triggers the side effect of sending a
 	// Reject of this Follow request in response.
 	OnFollowAutomaticallyReject
+	// OnFollowQueueForApproval records the Follow request as pending, so
+	// that it can be accepted or rejected later through the
+	// FollowApprovalActor. Requires the Database to implement
+	// PendingFollowsDatabase.
+	OnFollowQueueForApproval
 )
 
 // FederatingWrappedCallbacks lists the callback functions that already have
@@ -112,8 +117,14 @@ type FederatingWrappedCallbacks struct {
 	// It enforces that the actors on the Undo must correspond to all of the
 	// 'object' actors in some manner.
 	//
+	// The wrapping function then reverses the default side effects of
+	// undone Follow, Like, and Announce activities: the Follow's actors are
+	// removed from the 'followers' collection, and the Like or Announce is
+	// removed from the 'likes' or 'shares' collection of its objects.
+	//
 	// It is expected that the application will implement the proper
-	// reversal of activities that are being undone.
+	// reversal of any other side effects of activities that are being
+	// undone.
 	Undo func(context.Context, vocab.ActivityStreamsUndo) error
 	// Block handles additional side effects for the Block ActivityStreams
 	// type, specific to the application using go-fed.
@@ -123,6 +134,21 @@ type FederatingWrappedCallbacks struct {
 	// received from a federated peer, as delivering Blocks explicitly
 	// deviates from the original ActivityPub specification.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Move handles additional side effects for the Move ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// The wrapping function ensures the 'actor' of the Move is the moved
+	// 'object' actor, and that the 'target' actor lists the 'object' actor
+	// in its 'alsoKnownAs' property, such as when migrating accounts.
+	//
+	// If FollowMoveTarget is true and the actor owning this inbox follows
+	// the 'object' actor, a Follow is sent to the 'target' actor and an
+	// Undo of the Follow found in the outbox is sent to the 'object'
+	// actor.
+	Move func(context.Context, vocab.ActivityStreamsMove) error
+	// FollowMoveTarget determines whether the followers of an actor that
+	// moved follow its new account, when a Move is handled.
+	FollowMoveTarget bool
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -136,6 +162,8 @@ type FederatingWrappedCallbacks struct {
 	addNewIds func(c context.Context, activity Activity) error
 	// deliver delivers an outgoing message.
 	deliver func(c context.Context, outboxIRI *url.URL, activity Activity) error
+	// addToOutbox stores an outgoing message and adds it to the outbox.
+	addToOutbox func(c context.Context, outboxIRI *url.URL, activity Activity) error
 	// newTransport creates a new Transport.
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
 }
@@ -158,6 +186,7 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableAnnounce := true
 	enableUndo := true
 	enableBlock := true
+	enableMove := true
 	for _, fn := range fns {
 		switch fn.(type) {
 		default:
@@ -186,6 +215,8 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableUndo = false
 		case func(context.Context, vocab.ActivityStreamsBlock) error:
 			enableBlock = false
+		case func(context.Context, vocab.ActivityStreamsMove) error:
+			enableMove = false
 		}
 	}
 	if enableCreate {
@@ -224,6 +255,9 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableBlock {
 		fns = append(fns, w.block)
 	}
+	if enableMove {
+		fns = append(fns, w.move)
+	}
 	return fns
 }
 
@@ -397,81 +431,118 @@ func (w FederatingWrappedCallbacks) follow(c context.Context, a vocab.ActivitySt
 		}
 	}
 	if isMe {
-		// Prepare the response.
-		var response Activity
-		if w.OnFollow == OnFollowAutomaticallyAccept {
-			response = streams.NewActivityStreamsAccept()
-		} else if w.OnFollow == OnFollowAutomaticallyReject {
-			response = streams.NewActivityStreamsReject()
-		} else {
-			return fmt.Errorf("unknown OnFollowBehavior: %d", w.OnFollow)
-		}
-		// Set us as the 'actor'.
-		me := streams.NewActivityStreamsActorProperty()
-		response.SetActivityStreamsActor(me)
-		me.AppendIRI(actorIRI)
-		// Set the Follow as the 'object' property.
-		op := streams.NewActivityStreamsObjectProperty()
-		response.SetActivityStreamsObject(op)
-		op.AppendActivityStreamsFollow(a)
-		// Add all actors on the original Follow to the 'to' property.
-		recipients := make([]*url.URL, 0)
-		to := streams.NewActivityStreamsToProperty()
-		response.SetActivityStreamsTo(to)
-		followActors := a.GetActivityStreamsActor()
-		for iter := followActors.Begin(); iter != followActors.End(); iter = iter.Next() {
-			id, err := ToId(iter)
-			if err != nil {
+		switch w.OnFollow {
+		case OnFollowAutomaticallyAccept:
+			if err := w.respondToFollow(c, actorIRI, a, true); err != nil {
 				return err
 			}
-			to.AppendIRI(id)
-			recipients = append(recipients, id)
-		}
-		if w.OnFollow == OnFollowAutomaticallyAccept {
-			// If automatically accepting, then also update our
-			// followers collection with the new actors.
-			//
-			// If automatically rejecting, do not update the
-			// followers collection.
-			if err := w.db.Lock(c, actorIRI); err != nil {
+		case OnFollowAutomaticallyReject:
+			if err := w.respondToFollow(c, actorIRI, a, false); err != nil {
 				return err
 			}
-			// WARNING: Unlock not deferred.
-			followers, err := w.db.Followers(c, actorIRI)
-			if err != nil {
-				w.db.Unlock(c, actorIRI)
-				return err
-			}
-			items := followers.GetActivityStreamsItems()
-			for _, elem := range recipients {
-				items.PrependIRI(elem)
-			}
-			if err = w.db.Update(c, followers); err != nil {
-				w.db.Unlock(c, actorIRI)
+		case OnFollowQueueForApproval:
+			if err := w.queueFollow(c, actorIRI, a); err != nil {
 				return err
 			}
-			w.db.Unlock(c, actorIRI)
-			// Unlock must be called by now and every branch above.
+		default:
+			return fmt.Errorf("unknown OnFollowBehavior: %d", w.OnFollow)
 		}
-		// Lock without defer!
-		w.db.Lock(c, w.inboxIRI)
-		outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	}
+	if w.Follow != nil {
+		return w.Follow(c, a)
+	}
+	return nil
+}
+
+// queueFollow records the Follow of the actor as pending approval.
+func (w FederatingWrappedCallbacks) queueFollow(c context.Context, actorIRI *url.URL, a vocab.ActivityStreamsFollow) error {
+	pdb, ok := w.db.(PendingFollowsDatabase)
+	if !ok {
+		return fmt.Errorf("cannot queue follow for approval: database does not implement PendingFollowsDatabase")
+	}
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	if err := pdb.AddPendingFollow(c, actorIRI, a); err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	w.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	return nil
+}
+
+// respondToFollow sends an Accept or Reject of the Follow of the actor to the
+// actors of the Follow. When accepting, they are also added to the actor's
+// followers collection.
+func (w FederatingWrappedCallbacks) respondToFollow(c context.Context, actorIRI *url.URL, a vocab.ActivityStreamsFollow, accept bool) error {
+	// Prepare the response.
+	var response Activity
+	if accept {
+		response = streams.NewActivityStreamsAccept()
+	} else {
+		response = streams.NewActivityStreamsReject()
+	}
+	// Set us as the 'actor'.
+	me := streams.NewActivityStreamsActorProperty()
+	response.SetActivityStreamsActor(me)
+	me.AppendIRI(actorIRI)
+	// Set the Follow as the 'object' property.
+	op := streams.NewActivityStreamsObjectProperty()
+	response.SetActivityStreamsObject(op)
+	op.AppendActivityStreamsFollow(a)
+	// Add all actors on the original Follow to the 'to' property.
+	recipients := make([]*url.URL, 0)
+	to := streams.NewActivityStreamsToProperty()
+	response.SetActivityStreamsTo(to)
+	followActors := a.GetActivityStreamsActor()
+	for iter := followActors.Begin(); iter != followActors.End(); iter = iter.Next() {
+		id, err := ToId(iter)
 		if err != nil {
-			w.db.Unlock(c, w.inboxIRI)
 			return err
 		}
-		w.db.Unlock(c, w.inboxIRI)
-		// Everything must be unlocked by now.
-		if err := w.addNewIds(c, response); err != nil {
+		to.AppendIRI(id)
+		recipients = append(recipients, id)
+	}
+	if accept {
+		// If accepting, then also update our followers collection with
+		// the new actors.
+		//
+		// If rejecting, do not update the followers collection.
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		followers, err := w.db.Followers(c, actorIRI)
+		if err != nil {
+			w.db.Unlock(c, actorIRI)
 			return err
-		} else if err := w.deliver(c, outboxIRI, response); err != nil {
+		}
+		items := followers.GetActivityStreamsItems()
+		for _, elem := range recipients {
+			items.PrependIRI(elem)
+		}
+		if err = w.db.Update(c, followers); err != nil {
+			w.db.Unlock(c, actorIRI)
 			return err
 		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
 	}
-	if w.Follow != nil {
-		return w.Follow(c, a)
+	// Lock without defer!
+	w.db.Lock(c, w.inboxIRI)
+	outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
 	}
-	return nil
+	w.db.Unlock(c, w.inboxIRI)
+	// Everything must be unlocked by now.
+	if err := w.addNewIds(c, response); err != nil {
+		return err
+	}
+	return w.deliver(c, outboxIRI, response)
 }
 
 // accept implements the federating Accept activity side effects.
@@ -580,8 +651,8 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 				}
 				// Ensure that we are one of the actors on the Follow.
 				ok = false
-				actors := follow.GetActivityStreamsActor()
-				for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+				followActors := follow.GetActivityStreamsActor()
+				for iter := followActors.Begin(); iter != followActors.End(); iter = iter.Next() {
 					id, err := ToId(iter)
 					if err != nil {
 						return err
@@ -875,15 +946,150 @@ func (w FederatingWrappedCallbacks) undo(c context.Context, a vocab.ActivityStre
 		return ErrObjectRequired
 	}
 	actors := a.GetActivityStreamsActor()
-	if err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.inboxIRI); err != nil {
+	if err := mustHaveEmbeddedObjectsOnActorHosts(actors, op); err != nil {
+		return err
+	}
+	objects, err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.inboxIRI)
+	if err != nil {
 		return err
 	}
+	// Reverse the side effects applied when the activities were received.
+	for _, t := range objects {
+		switch v := t.(type) {
+		case vocab.ActivityStreamsFollow:
+			err = w.undoFollow(c, v)
+		case vocab.ActivityStreamsLike:
+			err = w.removeFromObjectsCollection(c, v, v.GetActivityStreamsObject(), func(t vocab.Type) vocab.Type {
+				if l, ok := t.(likeser); ok && l.GetActivityStreamsLikes() != nil {
+					return l.GetActivityStreamsLikes().GetType()
+				}
+				return nil
+			})
+		case vocab.ActivityStreamsAnnounce:
+			err = w.removeFromObjectsCollection(c, v, v.GetActivityStreamsObject(), func(t vocab.Type) vocab.Type {
+				if s, ok := t.(shareser); ok && s.GetActivityStreamsShares() != nil {
+					return s.GetActivityStreamsShares().GetType()
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
 	if w.Undo != nil {
 		return w.Undo(c, a)
 	}
 	return nil
 }
 
+// undoFollow removes the actors of the undone Follow from the followers
+// collection of the actor owning this inbox, if they were following it.
+func (w FederatingWrappedCallbacks) undoFollow(c context.Context, a vocab.ActivityStreamsFollow) error {
+	op := a.GetActivityStreamsObject()
+	followActors := a.GetActivityStreamsActor()
+	if op == nil || followActors == nil {
+		return nil
+	}
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	isMe := false
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if id.String() == actorIRI.String() {
+			isMe = true
+			break
+		}
+	}
+	if !isMe {
+		return nil
+	}
+	ids := make(map[string]bool, followActors.Len())
+	for iter := followActors.Begin(); iter != followActors.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		ids[id.String()] = true
+	}
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, actorIRI)
+	followers, err := w.db.Followers(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if removed, err := removeFromCollection(followers, ids); err != nil {
+		return err
+	} else if !removed {
+		return nil
+	}
+	return w.db.Update(c, followers)
+}
+
+// removeFromObjectsCollection removes the undone activity from a collection,
+// such as 'likes' or 'shares', on each of its objects owned by this server.
+func (w FederatingWrappedCallbacks) removeFromObjectsCollection(c context.Context, a vocab.Type, op vocab.ActivityStreamsObjectProperty, collection func(t vocab.Type) vocab.Type) error {
+	if op == nil {
+		return nil
+	}
+	id, err := GetId(a)
+	if err != nil {
+		return err
+	}
+	ids := map[string]bool{id.String(): true}
+	// Create anonymous loop function to be able to properly scope the defer
+	// for the database lock at each iteration.
+	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
+		objId, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, objId); err != nil {
+			return err
+		}
+		defer w.db.Unlock(c, objId)
+		if owns, err := w.db.Owns(c, objId); err != nil {
+			return err
+		} else if !owns {
+			return nil
+		}
+		t, err := w.db.Get(c, objId)
+		if err != nil {
+			return err
+		}
+		col := collection(t)
+		if col == nil {
+			return nil
+		}
+		if removed, err := removeFromCollection(col, ids); err != nil {
+			return err
+		} else if !removed {
+			return nil
+		}
+		return w.db.Update(c, t)
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		if err := loopFn(iter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // block implements the federating Block activity side effects.
 func (w FederatingWrappedCallbacks) block(c context.Context, a vocab.ActivityStreamsBlock) error {
 	op := a.GetActivityStreamsObject()
@@ -895,3 +1101,271 @@ func (w FederatingWrappedCallbacks) block(c context.Context, a vocab.ActivityStr
 	}
 	return nil
 }
+
+// move implements the federating Move activity side effects.
+func (w FederatingWrappedCallbacks) move(c context.Context, a vocab.ActivityStreamsMove) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	target := a.GetActivityStreamsTarget()
+	if target == nil || target.Len() == 0 {
+		return ErrTargetRequired
+	}
+	if op.Len() != 1 || target.Len() != 1 {
+		return fmt.Errorf("move must have exactly one object and one target")
+	}
+	originIRI, err := ToId(op.At(0))
+	if err != nil {
+		return err
+	}
+	targetIRI, err := ToId(target.At(0))
+	if err != nil {
+		return err
+	}
+	// Only an actor may move itself.
+	isOrigin := false
+	if actors := a.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			if id.String() == originIRI.String() {
+				isOrigin = true
+				break
+			}
+		}
+	}
+	if !isOrigin {
+		return fmt.Errorf("move of %s was not done by that actor", originIRI)
+	}
+	// Always dereference the target, instead of trusting an embedded
+	// value, to verify it is an alias of the origin.
+	tport, err := w.newTransport(c, w.inboxIRI, goFedUserAgent())
+	if err != nil {
+		return err
+	}
+	b, err := tport.Dereference(c, targetIRI)
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return err
+	}
+	isAlias := false
+	for _, aka := range getAlsoKnownAs(t) {
+		if aka.String() == originIRI.String() {
+			isAlias = true
+			break
+		}
+	}
+	if !isAlias {
+		return fmt.Errorf("move target %s does not list %s in alsoKnownAs", targetIRI, originIRI)
+	}
+	if w.FollowMoveTarget {
+		if err := w.followMoveTarget(c, originIRI, targetIRI); err != nil {
+			return err
+		}
+	}
+	if w.Move != nil {
+		return w.Move(c, a)
+	}
+	return nil
+}
+
+// followMoveTarget makes the actor owning this inbox follow the target of a
+// Move instead of its origin, if it was following the origin.
+func (w FederatingWrappedCallbacks) followMoveTarget(c context.Context, originIRI, targetIRI *url.URL) error {
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	//
+	// Stop following the origin, if it was followed at all.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	following, err := w.db.Following(c, actorIRI)
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	removed, err := removeFromCollection(following, map[string]bool{originIRI.String(): true})
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	} else if removed {
+		if err = w.db.Update(c, following); err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+	}
+	w.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	if !removed {
+		return nil
+	}
+	// Follow the target, and undo the Follow of the origin. The origin can
+	// only identify the Follow being undone by its id, so the Undo is
+	// only sent if the Follow is still in the outbox.
+	activities := []Activity{toFollow(actorIRI, targetIRI)}
+	follow, err := w.storedFollow(c, outboxIRI, actorIRI, originIRI)
+	if err != nil {
+		return err
+	} else if follow != nil {
+		undo := streams.NewActivityStreamsUndo()
+		me := streams.NewActivityStreamsActorProperty()
+		me.AppendIRI(actorIRI)
+		undo.SetActivityStreamsActor(me)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		undo.SetActivityStreamsObject(op)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(originIRI)
+		undo.SetActivityStreamsTo(to)
+		activities = append(activities, undo)
+	}
+	// Store each activity before delivering it, so that the Accept of the
+	// Follow can be matched to it, and a later Move can undo it.
+	for _, activity := range activities {
+		if err := w.addNewIds(c, activity); err != nil {
+			return err
+		} else if err := w.addToOutbox(c, outboxIRI, activity); err != nil {
+			return err
+		} else if err := w.deliver(c, outboxIRI, activity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedFollow finds the newest Follow of the object by the actor in the
+// actor's outbox. Returns nil if there is none.
+//
+// Only the first page of the outbox is searched, unless the Database is an
+// AppendCollectionDatabase.
+func (w FederatingWrappedCallbacks) storedFollow(c context.Context, outboxIRI, actorIRI, objectIRI *url.URL) (vocab.ActivityStreamsFollow, error) {
+	page := PageRequest{Page: true, Limit: DefaultPageSize}
+	for {
+		ids, err := w.outboxIds(c, outboxIRI, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			follow, err := w.getFollow(c, id)
+			if err != nil {
+				return nil, err
+			} else if follow != nil && isFollowOf(follow, actorIRI, objectIRI) {
+				return follow, nil
+			}
+		}
+		if _, ok := w.db.(AppendCollectionDatabase); !ok || len(ids) < page.Limit {
+			return nil, nil
+		}
+		page.MaxId = ids[len(ids)-1].String()
+	}
+}
+
+// outboxIds returns the ids of the items on a page of the outbox, newest
+// first.
+func (w FederatingWrappedCallbacks) outboxIds(c context.Context, outboxIRI *url.URL, page PageRequest) ([]*url.URL, error) {
+	if err := w.db.Lock(c, outboxIRI); err != nil {
+		return nil, err
+	}
+	defer w.db.Unlock(c, outboxIRI)
+	if adb, ok := w.db.(AppendCollectionDatabase); ok {
+		ids, _, err := adb.OutboxItems(c, outboxIRI, page)
+		return ids, err
+	}
+	outbox, err := w.db.GetOutbox(c, outboxIRI)
+	if err != nil {
+		return nil, err
+	}
+	oi := outbox.GetActivityStreamsOrderedItems()
+	if oi == nil {
+		return nil, nil
+	}
+	ids := make([]*url.URL, 0, oi.Len())
+	for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// getFollow fetches the value from the database, returning nil if it is not
+// a Follow.
+func (w FederatingWrappedCallbacks) getFollow(c context.Context, id *url.URL) (vocab.ActivityStreamsFollow, error) {
+	if err := w.db.Lock(c, id); err != nil {
+		return nil, err
+	}
+	defer w.db.Unlock(c, id)
+	t, err := w.db.Get(c, id)
+	if err != nil {
+		return nil, err
+	}
+	follow, _ := t.(vocab.ActivityStreamsFollow)
+	return follow, nil
+}
+
+// isFollowOf determines whether the Follow is by the actor, of the object.
+func isFollowOf(follow vocab.ActivityStreamsFollow, actorIRI, objectIRI *url.URL) bool {
+	byActor := false
+	if actors := follow.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			if id, err := ToId(iter); err == nil && id.String() == actorIRI.String() {
+				byActor = true
+				break
+			}
+		}
+	}
+	if !byActor {
+		return false
+	}
+	if op := follow.GetActivityStreamsObject(); op != nil {
+		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+			if id, err := ToId(iter); err == nil && id.String() == objectIRI.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toFollow creates a Follow of the object by the actor, addressed to the
+// object.
+func toFollow(actorIRI, objectIRI *url.URL) vocab.ActivityStreamsFollow {
+	follow := streams.NewActivityStreamsFollow()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	follow.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(objectIRI)
+	follow.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(objectIRI)
+	follow.SetActivityStreamsTo(to)
+	return follow
+}
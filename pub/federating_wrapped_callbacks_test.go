@@ -1,6 +1,13 @@
 package pub
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+	"net/url"
 	"testing"
 )
 
@@ -295,3 +302,618 @@ func TestFederatedBlock(t *testing.T) {
 		t.Errorf("Not yet implemented.")
 	})
 }
+
+// pendingFollowsDatabase is a MockDatabase keeping pending Follows in memory.
+type pendingFollowsDatabase struct {
+	*MockDatabase
+	pending []vocab.ActivityStreamsFollow
+}
+
+func (p *pendingFollowsDatabase) AddPendingFollow(c context.Context, actorIRI *url.URL, follow vocab.ActivityStreamsFollow) error {
+	p.pending = append(p.pending, follow)
+	return nil
+}
+
+func (p *pendingFollowsDatabase) PendingFollows(c context.Context, actorIRI *url.URL) ([]vocab.ActivityStreamsFollow, error) {
+	return p.pending, nil
+}
+
+func (p *pendingFollowsDatabase) RemovePendingFollow(c context.Context, actorIRI, followIRI *url.URL) (vocab.ActivityStreamsFollow, error) {
+	for i, f := range p.pending {
+		if f.GetJSONLDId().Get().String() == followIRI.String() {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+// TestFederatedFollowApproval tests queueing Follows for approval, and
+// responding to them later.
+func TestFederatedFollowApproval(t *testing.T) {
+	const (
+		testMyActorIRI     = "https://example.com/addison"
+		testMyFollowersIRI = "https://example.com/addison/followers"
+	)
+	ctx := context.Background()
+	newFollow := func() vocab.ActivityStreamsFollow {
+		f := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		f.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		f.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testMyActorIRI))
+		f.SetActivityStreamsObject(op)
+		return f
+	}
+	setupFn := func(ctl *gomock.Controller) (db *pendingFollowsDatabase, delivered *[]Activity, w FederatingWrappedCallbacks) {
+		db = &pendingFollowsDatabase{MockDatabase: NewMockDatabase(ctl)}
+		delivered = &[]Activity{}
+		w = FederatingWrappedCallbacks{
+			OnFollow: OnFollowQueueForApproval,
+			db:       db,
+			inboxIRI: mustParse(testMyInboxIRI),
+			addNewIds: func(c context.Context, activity Activity) error {
+				return nil
+			},
+			deliver: func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+				assertEqual(t, outboxIRI.String(), testMyOutboxIRI)
+				*delivered = append(*delivered, activity)
+				return nil
+			},
+		}
+		return
+	}
+	t.Run("QueuesFollowWithoutResponding", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, delivered, w := setupFn(ctl)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		err := w.follow(ctx, newFollow())
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(db.pending), 1)
+		assertEqual(t, len(*delivered), 0)
+	})
+	t.Run("ErrorsWithoutPendingFollowsDatabase", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, w := setupFn(ctl)
+		w.db = db.MockDatabase
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+		)
+		// Run
+		err := w.follow(ctx, newFollow())
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("AcceptUpdatesFollowersAndDelivers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, delivered, w := setupFn(ctl)
+		followers := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testMyFollowersIRI))
+		followers.SetJSONLDId(id)
+		followers.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Followers(ctx, mustParse(testMyActorIRI)).Return(followers, nil),
+			db.EXPECT().Update(ctx, followers),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+		)
+		// Run
+		err := w.respondToFollow(ctx, mustParse(testMyActorIRI), newFollow(), true)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, followers.GetActivityStreamsItems().At(0).GetIRI().String(), testFederatedActorIRI)
+		assertEqual(t, len(*delivered), 1)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsAccept((*delivered)[0]), true)
+		assertEqual(t, (*delivered)[0].GetActivityStreamsTo().At(0).GetIRI().String(), testFederatedActorIRI)
+	})
+	t.Run("RejectDoesNotUpdateFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, delivered, w := setupFn(ctl)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+		)
+		// Run
+		err := w.respondToFollow(ctx, mustParse(testMyActorIRI), newFollow(), false)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(*delivered), 1)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsReject((*delivered)[0]), true)
+	})
+	t.Run("ResolvingUnknownFollowErrors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, _ := setupFn(ctl)
+		a := &sideEffectActor{db: db}
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		err := a.AcceptFollow(ctx, mustParse(testMyInboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("KeepsFollowPendingIfDeliveryFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, _ := setupFn(ctl)
+		db.pending = []vocab.ActivityStreamsFollow{newFollow()}
+		common := NewMockCommonBehavior(ctl)
+		a := &sideEffectActor{common: common, db: db}
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().NewId(ctx, gomock.Any()).Return(mustParse(testNewActivityIRI), nil),
+		)
+		common.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(nil, fmt.Errorf("test error"))
+		// Run
+		err := a.RejectFollow(ctx, mustParse(testMyInboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify
+		assertNotEqual(t, err, nil)
+		assertEqual(t, len(db.pending), 1)
+	})
+}
+
+// TestFederatedUndoReversesSideEffects tests that undoing a Follow, Like, or
+// Announce reverses the side effects of receiving it.
+func TestFederatedUndoReversesSideEffects(t *testing.T) {
+	const testMyActorIRI = "https://example.com/addison"
+	ctx := context.Background()
+	// newUndo creates an Undo by the federated actor of the activity.
+	newUndo := func(activity vocab.Type) vocab.ActivityStreamsUndo {
+		u := streams.NewActivityStreamsUndo()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		u.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		if err := op.AppendType(activity); err != nil {
+			t.Fatal(err)
+		}
+		u.SetActivityStreamsObject(op)
+		return u
+	}
+	// newActivity sets the id, federated actor, and object of the activity.
+	newActivity := func(a interface {
+		vocab.Type
+		SetActivityStreamsActor(vocab.ActivityStreamsActorProperty)
+		SetActivityStreamsObject(vocab.ActivityStreamsObjectProperty)
+	}, object string) {
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		a.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		a.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(object))
+		a.SetActivityStreamsObject(op)
+	}
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, w FederatingWrappedCallbacks) {
+		db = NewMockDatabase(ctl)
+		w = FederatingWrappedCallbacks{
+			db:       db,
+			inboxIRI: mustParse(testMyInboxIRI),
+		}
+		return
+	}
+	t.Run("RemovesFollower", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, w := setupFn(ctl)
+		follow := streams.NewActivityStreamsFollow()
+		newActivity(follow, testMyActorIRI)
+		followers := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI2))
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		followers.SetActivityStreamsItems(items)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Followers(ctx, mustParse(testMyActorIRI)).Return(followers, nil),
+			db.EXPECT().Update(ctx, followers),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		err := w.undo(ctx, newUndo(follow))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, items.Len(), 1)
+		assertEqual(t, items.At(0).GetIRI().String(), testFederatedActorIRI2)
+	})
+	t.Run("RemovesLikeFromLikes", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, w := setupFn(ctl)
+		like := streams.NewActivityStreamsLike()
+		newActivity(like, testNoteId1)
+		note := streams.NewActivityStreamsNote()
+		likesCol := streams.NewActivityStreamsOrderedCollection()
+		oItems := streams.NewActivityStreamsOrderedItemsProperty()
+		oItems.AppendIRI(mustParse(testFederatedActivityIRI))
+		likesCol.SetActivityStreamsOrderedItems(oItems)
+		likes := streams.NewActivityStreamsLikesProperty()
+		likes.SetActivityStreamsOrderedCollection(likesCol)
+		note.SetActivityStreamsLikes(likes)
+		var updated vocab.Type
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testNoteId1)),
+			db.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil),
+			db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil),
+			db.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(c context.Context, t vocab.Type) error {
+				updated = t
+				return nil
+			}),
+			db.EXPECT().Unlock(ctx, mustParse(testNoteId1)),
+		)
+		// Run
+		err := w.undo(ctx, newUndo(like))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, updated, vocab.Type(note))
+		assertEqual(t, oItems.Len(), 0)
+	})
+	t.Run("RejectsLikeWithForeignId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, w := setupFn(ctl)
+		like := streams.NewActivityStreamsLike()
+		newActivity(like, testNoteId1)
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI))
+		like.SetJSONLDId(id)
+		called := false
+		w.Undo = func(c context.Context, u vocab.ActivityStreamsUndo) error {
+			called = true
+			return nil
+		}
+		// Run
+		err := w.undo(ctx, newUndo(like))
+		// Verify
+		assertNotEqual(t, err, nil)
+		assertEqual(t, called, false)
+	})
+	t.Run("IgnoresAnnounceOfUnownedObject", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, w := setupFn(ctl)
+		announce := streams.NewActivityStreamsAnnounce()
+		newActivity(announce, testNoteId1)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testNoteId1)),
+			db.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(false, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testNoteId1)),
+		)
+		// Run
+		err := w.undo(ctx, newUndo(announce))
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("CallsCustomCallbackAfterwards", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, w := setupFn(ctl)
+		called := false
+		w.Undo = func(c context.Context, u vocab.ActivityStreamsUndo) error {
+			called = true
+			return nil
+		}
+		listen := streams.NewActivityStreamsListen()
+		newActivity(listen, testNoteId1)
+		// Run
+		err := w.undo(ctx, newUndo(listen))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, called, true)
+	})
+}
+
+// TestFederatedMove tests the side effects of an actor moving to a new
+// account.
+func TestFederatedMove(t *testing.T) {
+	const (
+		testMyActorIRI  = "https://example.com/addison"
+		testNewActorIRI = "https://new.example.com/dakota"
+	)
+	ctx := context.Background()
+	newMove := func(actor string) vocab.ActivityStreamsMove {
+		m := streams.NewActivityStreamsMove()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		m.SetJSONLDId(id)
+		actorProp := streams.NewActivityStreamsActorProperty()
+		actorProp.AppendIRI(mustParse(actor))
+		m.SetActivityStreamsActor(actorProp)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		m.SetActivityStreamsObject(op)
+		target := streams.NewActivityStreamsTargetProperty()
+		target.AppendIRI(mustParse(testNewActorIRI))
+		m.SetActivityStreamsTarget(target)
+		return m
+	}
+	// newTargetActor serializes the new actor, with the given aliases.
+	newTargetActor := func(alsoKnownAs ...interface{}) []byte {
+		p := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActorIRI))
+		p.SetJSONLDId(id)
+		m, err := streams.Serialize(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m["alsoKnownAs"] = alsoKnownAs
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, tp *MockTransport, delivered *[]Activity, w FederatingWrappedCallbacks) {
+		db = NewMockDatabase(ctl)
+		tp = NewMockTransport(ctl)
+		delivered = &[]Activity{}
+		w = FederatingWrappedCallbacks{
+			db:       db,
+			inboxIRI: mustParse(testMyInboxIRI),
+			newTransport: func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+				return tp, nil
+			},
+			addNewIds: func(c context.Context, activity Activity) error {
+				return nil
+			},
+			deliver: func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+				*delivered = append(*delivered, activity)
+				return nil
+			},
+			addToOutbox: func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+				return nil
+			},
+		}
+		return
+	}
+	t.Run("ErrorsIfActorIsNotObject", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, w := setupFn(ctl)
+		// Run
+		err := w.move(ctx, newMove(testFederatedActorIRI2))
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("ErrorsIfTargetIsNotAlias", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, tp, _, w := setupFn(ctl)
+		tp.EXPECT().Dereference(ctx, mustParse(testNewActorIRI)).Return(newTargetActor(testFederatedActorIRI2), nil)
+		called := false
+		w.Move = func(c context.Context, m vocab.ActivityStreamsMove) error {
+			called = true
+			return nil
+		}
+		// Run
+		err := w.move(ctx, newMove(testFederatedActorIRI))
+		// Verify
+		assertNotEqual(t, err, nil)
+		assertEqual(t, called, false)
+	})
+	t.Run("CallsCustomCallbackIfTargetIsAlias", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, tp, delivered, w := setupFn(ctl)
+		tp.EXPECT().Dereference(ctx, mustParse(testNewActorIRI)).Return(newTargetActor(testFederatedActorIRI), nil)
+		called := false
+		w.Move = func(c context.Context, m vocab.ActivityStreamsMove) error {
+			called = true
+			return nil
+		}
+		// Run
+		err := w.move(ctx, newMove(testFederatedActorIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, called, true)
+		assertEqual(t, len(*delivered), 0)
+	})
+	t.Run("FollowsTargetInsteadOfOrigin", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, tp, delivered, w := setupFn(ctl)
+		w.FollowMoveTarget = true
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		following.SetActivityStreamsItems(items)
+		sentFollow := toFollow(mustParse(testMyActorIRI), mustParse(testFederatedActorIRI))
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI2))
+		sentFollow.SetJSONLDId(id)
+		outbox := streams.NewActivityStreamsOrderedCollectionPage()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testNewActivityIRI))
+		oi.AppendIRI(mustParse(testNewActivityIRI2))
+		outbox.SetActivityStreamsOrderedItems(oi)
+		tp.EXPECT().Dereference(ctx, mustParse(testNewActorIRI)).Return(newTargetActor(testFederatedActorIRI), nil)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Following(ctx, mustParse(testMyActorIRI)).Return(following, nil),
+			db.EXPECT().Update(ctx, following),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI)).Return(outbox, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testNewActivityIRI)),
+			db.EXPECT().Get(ctx, mustParse(testNewActivityIRI)).Return(testMyNote, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testNewActivityIRI2)),
+			db.EXPECT().Get(ctx, mustParse(testNewActivityIRI2)).Return(sentFollow, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI2)),
+		)
+		// Run
+		err := w.move(ctx, newMove(testFederatedActorIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, items.Len(), 0)
+		assertEqual(t, len(*delivered), 2)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsFollow((*delivered)[0]), true)
+		assertEqual(t, (*delivered)[0].GetActivityStreamsObject().At(0).GetIRI().String(), testNewActorIRI)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsUndo((*delivered)[1]), true)
+		assertEqual(t, (*delivered)[1].GetActivityStreamsTo().At(0).GetIRI().String(), testFederatedActorIRI)
+		undone := (*delivered)[1].GetActivityStreamsObject().At(0).GetActivityStreamsFollow()
+		assertEqual(t, undone.GetJSONLDId().Get().String(), testNewActivityIRI2)
+	})
+	t.Run("FollowsTargetOnceItAccepts", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, tp, delivered, w := setupFn(ctl)
+		w.FollowMoveTarget = true
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		following.SetActivityStreamsItems(items)
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(testNewActivityIRI))
+			activity.SetJSONLDId(id)
+			return nil
+		}
+		var stored Activity
+		w.addToOutbox = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			assertEqual(t, outboxIRI.String(), testMyOutboxIRI)
+			assertEqual(t, len(*delivered), 0)
+			stored = activity
+			return nil
+		}
+		tp.EXPECT().Dereference(ctx, mustParse(testNewActorIRI)).Return(newTargetActor(testFederatedActorIRI), nil)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Following(ctx, mustParse(testMyActorIRI)).Return(following, nil),
+			db.EXPECT().Update(ctx, following),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI)).Return(streams.NewActivityStreamsOrderedCollectionPage(), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+			// Accept
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testNewActivityIRI)),
+			db.EXPECT().Get(ctx, mustParse(testNewActivityIRI)).DoAndReturn(func(c context.Context, id *url.URL) (vocab.Type, error) {
+				if stored == nil {
+					return nil, fmt.Errorf("no Follow %s", id)
+				}
+				return stored, nil
+			}),
+			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Following(ctx, mustParse(testMyActorIRI)).Return(following, nil),
+			db.EXPECT().Update(ctx, following),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		err := w.move(ctx, newMove(testFederatedActorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, len(*delivered), 1)
+		accept := streams.NewActivityStreamsAccept()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testNewActorIRI))
+		accept.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow((*delivered)[0].(vocab.ActivityStreamsFollow))
+		accept.SetActivityStreamsObject(op)
+		// Run
+		err = w.accept(ctx, accept)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, items.Len(), 1)
+		assertEqual(t, items.At(0).GetIRI().String(), testNewActorIRI)
+	})
+	t.Run("DoesNotUndoUnknownFollow", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, tp, delivered, w := setupFn(ctl)
+		w.FollowMoveTarget = true
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		following.SetActivityStreamsItems(items)
+		tp.EXPECT().Dereference(ctx, mustParse(testNewActorIRI)).Return(newTargetActor(testFederatedActorIRI), nil)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testMyOutboxIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Following(ctx, mustParse(testMyActorIRI)).Return(following, nil),
+			db.EXPECT().Update(ctx, following),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI)).Return(streams.NewActivityStreamsOrderedCollectionPage(), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+		)
+		// Run
+		err := w.move(ctx, newMove(testFederatedActorIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(*delivered), 1)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsFollow((*delivered)[0]), true)
+	})
+}
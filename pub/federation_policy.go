@@ -0,0 +1,244 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// PolicyAction is a set of actions a FederationPolicy applies to a domain or
+// actor. Actions are combined with bitwise OR.
+type PolicyAction uint
+
+const (
+	// PolicyAllow permits federating with the domain or actor when the
+	// FederationPolicy only allows explicitly allowed peers.
+	PolicyAllow PolicyAction = 1 << iota
+	// PolicyReject refuses activities from, deliveries to, and fetches
+	// from the domain or actor.
+	PolicyReject
+	// PolicyStripMedia removes the 'attachment' of received activities and
+	// of their embedded objects.
+	PolicyStripMedia
+	// PolicyForceUnlisted moves the Public collection from the 'to' of
+	// received activities and of their embedded objects into their 'cc'.
+	PolicyForceUnlisted
+)
+
+// FederationPolicy decides which peers this server federates with, and how,
+// based on rules for domains and for individual actors.
+//
+// A CommonBehavior that implements FederationPolicer has the policy applied
+// when authorizing activities POSTed to inboxes, when determining the
+// recipients of deliveries, and to every request made by the Transports it
+// creates.
+//
+// A FederationPolicy is safe for concurrent use, so its rules may be changed
+// while it is in use.
+type FederationPolicy struct {
+	allowOnly bool
+	mu        sync.RWMutex
+	domains   map[string]PolicyAction
+	actors    map[string]PolicyAction
+}
+
+// NewFederationPolicy creates a FederationPolicy without rules.
+//
+// If allowOnly is true, then only domains and actors with a PolicyAllow rule
+// are federated with. This server's own domain then needs a PolicyAllow rule
+// as well.
+func NewFederationPolicy(allowOnly bool) *FederationPolicy {
+	return &FederationPolicy{
+		allowOnly: allowOnly,
+		domains:   make(map[string]PolicyAction),
+		actors:    make(map[string]PolicyAction),
+	}
+}
+
+// SetDomainRule sets the actions for the domain and all of its subdomains,
+// replacing any previous rule. A zero action removes the rule.
+func (p *FederationPolicy) SetDomainRule(domain string, a PolicyAction) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if a == 0 {
+		delete(p.domains, domain)
+	} else {
+		p.domains[domain] = a
+	}
+}
+
+// SetActorRule sets the actions for the actor, replacing any previous rule. An
+// actor's rule takes precedence over the rules of its domain. A zero action
+// removes the rule.
+func (p *FederationPolicy) SetActorRule(actorIRI *url.URL, a PolicyAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if a == 0 {
+		delete(p.actors, actorIRI.String())
+	} else {
+		p.actors[actorIRI.String()] = a
+	}
+}
+
+// Actions returns the actions applied to the IRI: its actor rule if it has
+// one, otherwise the rule of its most specific domain.
+//
+// When only allowed peers are federated with, IRIs without PolicyAllow are
+// also rejected.
+func (p *FederationPolicy) Actions(iri *url.URL) PolicyAction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	a, ok := p.actors[iri.String()]
+	if !ok {
+		host := strings.ToLower(strings.TrimSuffix(iri.Hostname(), "."))
+		for len(host) > 0 {
+			if a, ok = p.domains[host]; ok {
+				break
+			}
+			i := strings.Index(host, ".")
+			if i < 0 {
+				break
+			}
+			host = host[i+1:]
+		}
+	}
+	if p.allowOnly && a&PolicyAllow == 0 {
+		a |= PolicyReject
+	}
+	return a
+}
+
+// Rejects returns true if the IRI must not be federated with.
+func (p *FederationPolicy) Rejects(iri *url.URL) bool {
+	return p.Actions(iri)&PolicyReject != 0
+}
+
+// filter returns the IRIs that are not rejected.
+func (p *FederationPolicy) filter(iris []*url.URL) (allowed []*url.URL) {
+	for _, iri := range iris {
+		if !p.Rejects(iri) {
+			allowed = append(allowed, iri)
+		}
+	}
+	return
+}
+
+// activityActions returns the actions applied to the activity, which are the
+// combined actions of its id and of its actors.
+func (p *FederationPolicy) activityActions(activity Activity) (a PolicyAction, err error) {
+	id, err := GetId(activity)
+	if err != nil {
+		return
+	}
+	a = p.Actions(id)
+	if actor := activity.GetActivityStreamsActor(); actor != nil {
+		for iter := actor.Begin(); iter != actor.End(); iter = iter.Next() {
+			var actorIRI *url.URL
+			actorIRI, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			a |= p.Actions(actorIRI)
+		}
+	}
+	return
+}
+
+// apply modifies the activity and its embedded objects according to the
+// actions.
+func (p *FederationPolicy) apply(activity Activity, a PolicyAction) {
+	types := []vocab.Type{activity}
+	if op := activity.GetActivityStreamsObject(); op != nil {
+		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+			if t := iter.GetType(); t != nil {
+				types = append(types, t)
+			}
+		}
+	}
+	for _, t := range types {
+		if a&PolicyStripMedia != 0 {
+			if v, ok := t.(attachmenter); ok {
+				v.SetActivityStreamsAttachment(nil)
+			}
+		}
+		if a&PolicyForceUnlisted != 0 {
+			forceUnlisted(t)
+		}
+	}
+}
+
+// forceUnlisted moves the Public collection from the 'to' of the type into
+// its 'cc'.
+func forceUnlisted(t vocab.Type) {
+	to, ok := t.(toer)
+	if !ok || to.GetActivityStreamsTo() == nil {
+		return
+	}
+	top := to.GetActivityStreamsTo()
+	var public []*url.URL
+	for i := top.Len() - 1; i >= 0; i-- {
+		if iri := top.At(i).GetIRI(); iri != nil && IsPublic(iri.String()) {
+			public = append(public, iri)
+			top.Remove(i)
+		}
+	}
+	if len(public) == 0 {
+		return
+	}
+	cc, ok := t.(ccer)
+	if !ok {
+		return
+	}
+	ccp := cc.GetActivityStreamsCc()
+	if ccp == nil {
+		ccp = streams.NewActivityStreamsCcProperty()
+		cc.SetActivityStreamsCc(ccp)
+	}
+	for _, iri := range public {
+		ccp.AppendIRI(iri)
+	}
+}
+
+// FederationPolicer is optionally implemented by a CommonBehavior in order to
+// apply a FederationPolicy.
+type FederationPolicer interface {
+	// FederationPolicy returns the policy to apply. Returning nil applies
+	// no policy.
+	FederationPolicy(c context.Context) *FederationPolicy
+}
+
+// Transport must be implemented by policyTransport.
+var _ Transport = &policyTransport{}
+
+// policyTransport is a Transport that refuses to make requests to peers
+// rejected by a FederationPolicy.
+type policyTransport struct {
+	Transport
+	policy *FederationPolicy
+}
+
+// Dereference fetches the IRI unless it is rejected.
+func (p *policyTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	if p.policy.Rejects(iri) {
+		return nil, fmt.Errorf("federation policy rejects %s", iri)
+	}
+	return p.Transport.Dereference(c, iri)
+}
+
+// Deliver sends to the recipient unless it is rejected.
+func (p *policyTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	if p.policy.Rejects(to) {
+		return fmt.Errorf("federation policy rejects %s", to)
+	}
+	return p.Transport.Deliver(c, b, to)
+}
+
+// BatchDeliver sends to the recipients that are not rejected.
+func (p *policyTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	return p.Transport.BatchDeliver(c, b, p.policy.filter(recipients))
+}
@@ -0,0 +1,161 @@
+package pub
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// policingCommonBehavior is a CommonBehavior that applies a FederationPolicy.
+type policingCommonBehavior struct {
+	*MockCommonBehavior
+	p *FederationPolicy
+}
+
+func (p *policingCommonBehavior) FederationPolicy(c context.Context) *FederationPolicy {
+	return p.p
+}
+
+// TestFederationPolicy tests the rules of a FederationPolicy.
+func TestFederationPolicy(t *testing.T) {
+	t.Run("AppliesDomainRulesToSubdomains", func(t *testing.T) {
+		// Setup
+		p := NewFederationPolicy(false)
+		p.SetDomainRule("example.com", PolicyReject)
+		// Verify
+		assertEqual(t, p.Rejects(mustParse(testFederatedActorIRI)), true)
+		assertEqual(t, p.Rejects(mustParse("https://example.org/dakota")), false)
+	})
+	t.Run("UsesMostSpecificDomainRule", func(t *testing.T) {
+		// Setup
+		p := NewFederationPolicy(false)
+		p.SetDomainRule("example.com", PolicyReject)
+		p.SetDomainRule("other.example.com", PolicyStripMedia)
+		// Verify
+		assertEqual(t, p.Actions(mustParse(testFederatedActorIRI)), PolicyStripMedia)
+		assertEqual(t, p.Actions(mustParse(testPersonIRI)), PolicyReject)
+	})
+	t.Run("ActorRuleOverridesDomainRule", func(t *testing.T) {
+		// Setup
+		p := NewFederationPolicy(false)
+		p.SetDomainRule("other.example.com", PolicyReject)
+		p.SetActorRule(mustParse(testFederatedActorIRI), PolicyForceUnlisted)
+		// Verify
+		assertEqual(t, p.Actions(mustParse(testFederatedActorIRI)), PolicyForceUnlisted)
+		assertEqual(t, p.Rejects(mustParse(testFederatedActorIRI2)), true)
+	})
+	t.Run("AllowOnlyRejectsUnlisted", func(t *testing.T) {
+		// Setup
+		p := NewFederationPolicy(true)
+		p.SetDomainRule("example.com", PolicyAllow)
+		// Verify
+		assertEqual(t, p.Rejects(mustParse(testFederatedActorIRI)), false)
+		assertEqual(t, p.Rejects(mustParse("https://example.org/dakota")), true)
+	})
+	t.Run("RemovesRules", func(t *testing.T) {
+		// Setup
+		p := NewFederationPolicy(false)
+		p.SetDomainRule("example.com", PolicyReject)
+		// Run
+		p.SetDomainRule("example.com", 0)
+		// Verify
+		assertEqual(t, p.Rejects(mustParse(testFederatedActorIRI)), false)
+	})
+}
+
+// TestFederationPolicyAuthorizePostInbox tests applying a FederationPolicy to
+// activities received in an inbox.
+func TestFederationPolicyAuthorizePostInbox(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (p *FederationPolicy, fp *MockFederatingProtocol, a DelegateActor) {
+		setupData()
+		p = NewFederationPolicy(false)
+		fp = NewMockFederatingProtocol(ctl)
+		a = &sideEffectActor{
+			common: &policingCommonBehavior{NewMockCommonBehavior(ctl), p},
+			s2s:    fp,
+			c2s:    NewMockSocialProtocol(ctl),
+			db:     NewMockDatabase(ctl),
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	t.Run("RejectsActivity", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, fp, a := setupFn(ctl)
+		p.SetDomainRule("other.example.com", PolicyReject)
+		fp.EXPECT().Blocked(ctx, []*url.URL{mustParse(testFederatedActorIRI)}).Return(false, nil)
+		resp := httptest.NewRecorder()
+		// Run
+		b, err := a.AuthorizePostInbox(ctx, resp, testCreate)
+		// Verify
+		assertEqual(t, b, false)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("StripsMediaAndForcesUnlisted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, fp, a := setupFn(ctl)
+		p.SetActorRule(mustParse(testFederatedActorIRI), PolicyStripMedia|PolicyForceUnlisted)
+		fp.EXPECT().Blocked(ctx, []*url.URL{mustParse(testFederatedActorIRI)}).Return(false, nil)
+		attachment := streams.NewActivityStreamsAttachmentProperty()
+		attachment.AppendIRI(mustParse("https://other.example.com/media/1"))
+		testFederatedNote.SetActivityStreamsAttachment(attachment)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		testFederatedNote.SetActivityStreamsTo(to)
+		// Run
+		b, err := a.AuthorizePostInbox(ctx, httptest.NewRecorder(), testCreate)
+		// Verify
+		assertEqual(t, b, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, testFederatedNote.GetActivityStreamsAttachment(), nil)
+		assertEqual(t, testFederatedNote.GetActivityStreamsTo().Len(), 0)
+		assertEqual(t, testFederatedNote.GetActivityStreamsCc().At(0).GetIRI().String(), PublicActivityPubIRI)
+	})
+}
+
+// TestPolicyTransport tests that Transports refuse requests to rejected peers.
+func TestPolicyTransport(t *testing.T) {
+	ctx := context.Background()
+	payload := []byte("{}")
+	setupFn := func(ctl *gomock.Controller) (tp *MockTransport, pt Transport) {
+		p := NewFederationPolicy(false)
+		p.SetDomainRule("other.example.com", PolicyReject)
+		tp = NewMockTransport(ctl)
+		pt = &policyTransport{Transport: tp, policy: p}
+		return
+	}
+	t.Run("RefusesDereference", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, pt := setupFn(ctl)
+		// Run
+		_, err := pt.Dereference(ctx, mustParse(testFederatedActorIRI))
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("FiltersBatchDeliver", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, pt := setupFn(ctl)
+		tp.EXPECT().BatchDeliver(ctx, payload, []*url.URL{mustParse(testPersonIRI)}).Return(nil)
+		// Run
+		err := pt.BatchDeliver(ctx, payload, []*url.URL{
+			mustParse(testFederatedActorIRI),
+			mustParse(testPersonIRI),
+		})
+		// Verify
+		assertEqual(t, err, nil)
+	})
+}
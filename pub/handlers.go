@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 	"net/http"
 )
 
@@ -22,7 +23,8 @@ import (
 // If 'isASRequest' is true and there is no error, then the HandlerFunc
 // successfully served the request and wrote to the ResponseWriter.
 //
-// Callers are responsible for authorized access to this resource.
+// Callers are responsible for authorized access to this resource, unless the
+// HandlerFunc documents otherwise.
 type HandlerFunc func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error)
 
 // NewActivityStreamsHandler creates a HandlerFunc to serve ActivityStreams
@@ -32,7 +34,26 @@ type HandlerFunc func(c context.Context, w http.ResponseWriter, r *http.Request)
 // Strips retrieved ActivityStreams values of sensitive fields ('bto' and 'bcc')
 // before responding with them. Sets the appropriate HTTP status code for
 // Tombstone Activities as well.
+//
+// Responses have a strong ETag, and a Last-Modified taken from the value's
+// 'updated' or else 'published' property. Conditional requests for unchanged
+// values are answered with http.StatusNotModified. If the Database is a
+// CachePolicer, it sets the Cache-Control header.
+//
+// See NewAuthorizedFetchHandler to only serve data to the actors it is
+// addressed to.
 func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
+	return newActivityStreamsHandler(db, clock, nil)
+}
+
+// fetchAuthorizer determines whether the request may obtain the
+// ActivityStreams value. A non-zero status denies the request, and is written
+// in the response.
+type fetchAuthorizer func(c context.Context, r *http.Request, t vocab.Type) (status int, err error)
+
+// newActivityStreamsHandler creates a HandlerFunc to serve ActivityStreams
+// data, if permitted by the authorizer. A nil authorizer permits all requests.
+func newActivityStreamsHandler(db Database, clock Clock, authorize fetchAuthorizer) HandlerFunc {
 	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
 		// Do nothing if it is not an ActivityPub GET request
 		if !isActivityPubGet(r) {
@@ -55,6 +76,18 @@ func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
 		// Unlock must have been called by this point and in every
 		// branch above
 		//
+		// Check the requester may obtain the value, which needs its
+		// sensitive fields.
+		if authorize != nil {
+			var status int
+			status, err = authorize(c, r, t)
+			if err != nil {
+				return
+			} else if status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+		}
 		// Remove sensitive fields.
 		clearSensitiveFields(t)
 		// Serialize the fetched value.
@@ -68,9 +101,13 @@ func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
 		}
 		// Construct the response.
 		addResponseHeaders(w.Header(), clock, raw)
+		addCachingHeaders(c, w.Header(), db, t, raw)
 		// Write the response.
 		if streams.IsOrExtendsActivityStreamsTombstone(t) {
 			w.WriteHeader(http.StatusGone)
+		} else if isNotModified(r, w.Header()) {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		} else {
 			w.WriteHeader(http.StatusOK)
 		}
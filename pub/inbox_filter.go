@@ -0,0 +1,62 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// InboxFilter inspects, and optionally rewrites, an activity POSTed to an
+// inbox after it has been authorized but before any side effects occur.
+//
+// To accept the activity unchanged, return a nil rewritten Activity and a zero
+// rejectStatus. To accept it with changes, return the rewritten Activity, which
+// must keep the original's id. To reject it, return a non-zero rejectStatus,
+// such as http.StatusForbidden, which is written in the response.
+//
+// If an error is returned, it is passed back to the caller of PostInbox or
+// PostSharedInbox, and no response is written.
+type InboxFilter func(c context.Context, inboxIRI *url.URL, activity Activity) (rewritten Activity, rejectStatus int, err error)
+
+// InboxFilterer is optionally implemented by a FederatingProtocol or a
+// DelegateActor in order to filter the activities POSTed to inboxes.
+type InboxFilterer interface {
+	// InboxFilters returns the filters to apply, in order. Each filter is
+	// given the activity as rewritten by the filters before it, and the
+	// first one to reject the activity stops the chain.
+	InboxFilters(c context.Context) []InboxFilter
+}
+
+// applyInboxFilters runs the activity through the filters in order.
+//
+// If ok is false and the error is nil, then a response has already been
+// written.
+func applyInboxFilters(c context.Context, w http.ResponseWriter, filters []InboxFilter, inboxIRI *url.URL, activity Activity) (out Activity, ok bool, err error) {
+	id, err := GetId(activity)
+	if err != nil {
+		return
+	}
+	for _, filter := range filters {
+		var rewritten Activity
+		var status int
+		rewritten, status, err = filter(c, inboxIRI, activity)
+		if err != nil {
+			return
+		} else if status != 0 {
+			w.WriteHeader(status)
+			return
+		} else if rewritten == nil {
+			continue
+		}
+		var rewrittenId *url.URL
+		if rewrittenId, err = GetId(rewritten); err != nil {
+			return
+		} else if rewrittenId.String() != id.String() {
+			err = fmt.Errorf("inbox filter changed the activity id from %s to %s", id, rewrittenId)
+			return
+		}
+		activity = rewritten
+	}
+	return activity, true, nil
+}
@@ -0,0 +1,103 @@
+package pub
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// filteringDelegateActor is a DelegateActor that applies InboxFilters.
+type filteringDelegateActor struct {
+	*MockDelegateActor
+	filters []InboxFilter
+}
+
+func (f *filteringDelegateActor) InboxFilters(c context.Context) []InboxFilter {
+	return f.filters
+}
+
+// TestInboxFilters tests filtering activities POSTed to an inbox.
+func TestInboxFilters(t *testing.T) {
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, filters ...InboxFilter) (delegate *MockDelegateActor, a FederatingActor) {
+		delegate = NewMockDelegateActor(ctl)
+		a = NewCustomActor(
+			&filteringDelegateActor{delegate, filters},
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		return
+	}
+	expectAuthorized := func(delegate *MockDelegateActor, resp http.ResponseWriter, req *http.Request) {
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+	}
+	accept := func(c context.Context, inboxIRI *url.URL, activity Activity) (Activity, int, error) {
+		return nil, 0, nil
+	}
+	t.Run("RejectsWithStatus", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		var called bool
+		delegate, a := setupFn(ctl, func(c context.Context, inboxIRI *url.URL, activity Activity) (Activity, int, error) {
+			return nil, http.StatusUnprocessableEntity, nil
+		}, func(c context.Context, inboxIRI *url.URL, activity Activity) (Activity, int, error) {
+			called = true
+			return nil, 0, nil
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		expectAuthorized(delegate, resp, req)
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusUnprocessableEntity)
+		assertEqual(t, called, false)
+	})
+	t.Run("PostsRewrittenActivity", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		var gotInbox *url.URL
+		delegate, a := setupFn(ctl, accept, func(c context.Context, inboxIRI *url.URL, activity Activity) (Activity, int, error) {
+			gotInbox = inboxIRI
+			return testCreate2, 0, nil
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		expectAuthorized(delegate, resp, req)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), testCreate2).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), testCreate2).Return(nil)
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, gotInbox.String(), testMyInboxIRI)
+	})
+	t.Run("ErrorsWhenRewritingId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, a := setupFn(ctl, func(c context.Context, inboxIRI *url.URL, activity Activity) (Activity, int, error) {
+			return testMyCreate, 0, nil
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		expectAuthorized(delegate, resp, req)
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertNotEqual(t, err, nil)
+		assertEqual(t, handled, true)
+	})
+}
@@ -0,0 +1,333 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InboxItem is a single activity received in an inbox, awaiting processing by
+// an InboxQueue.
+type InboxItem struct {
+	// Id uniquely identifies this InboxItem within an InboxStore. It is
+	// assigned by the InboxStore when enqueued.
+	Id string
+	// InboxIRI is the inbox the activity was received in.
+	InboxIRI *url.URL
+	// Recipients are the inboxes of the local actors that an activity
+	// received in the shared inbox is for. It is empty for activities
+	// received in an actor's own inbox.
+	Recipients []*url.URL
+	// Payload is the serialized activity.
+	Payload []byte
+	// Received is when the activity was enqueued.
+	Received time.Time
+}
+
+// InboxStore durably persists received activities for an InboxQueue.
+//
+// An InboxStore is expected to be used by only one InboxQueue at a time, which
+// is the sole consumer of its InboxItems.
+type InboxStore interface {
+	// Enqueue persists a new InboxItem, assigning it a unique Id.
+	Enqueue(c context.Context, i *InboxItem) error
+	// Pending returns at most max InboxItems, earliest received first.
+	Pending(c context.Context, max int) ([]*InboxItem, error)
+	// Remove deletes an InboxItem that has been processed.
+	Remove(c context.Context, i *InboxItem) error
+}
+
+const (
+	// inboxQueuePollInterval is how often the InboxQueue checks the
+	// InboxStore for InboxItems it has not yet been woken up for, such as
+	// those persisted before a restart.
+	inboxQueuePollInterval = 5 * time.Second
+	// inboxQueueBatchSize is the maximum number of InboxItems fetched from
+	// the InboxStore at once.
+	inboxQueueBatchSize = 100
+)
+
+// inboxProcessor processes activities taken from an InboxQueue.
+type inboxProcessor interface {
+	// processInboxItem applies the side effects of the activity.
+	processInboxItem(c context.Context, inboxIRI *url.URL, activity Activity) error
+	// processSharedInboxItem applies the side effects of the activity
+	// received in the shared inbox for each of the inboxes.
+	processSharedInboxItem(c context.Context, inboxes []*url.URL, activity Activity) error
+}
+
+// inboxProcessor must be implemented by baseActorFederating.
+var _ inboxProcessor = &baseActorFederating{}
+
+// InboxQueue applies the side effects of activities received in inboxes in
+// the background, so that peers are answered as soon as the activities are
+// durably enqueued.
+//
+// A CommonBehavior or DelegateActor that implements InboxQueuer has the
+// activities POSTed to its inboxes, and to the shared inbox, enqueued and
+// answered with http.StatusAccepted.
+type InboxQueue struct {
+	store   InboxStore
+	clock   Clock
+	workers int
+	// OnError, if set, is called when processing an InboxItem fails. The
+	// InboxItem is removed from the InboxStore regardless, as its side
+	// effects may have been partially applied.
+	OnError   func(c context.Context, i *InboxItem, err error)
+	processor inboxProcessor
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	startMu   sync.Mutex
+	started   bool
+}
+
+// NewInboxQueue creates an InboxQueue backed by the given store. At most
+// 'workers' activities are processed concurrently.
+//
+// Start must be called before any activities are processed.
+func NewInboxQueue(store InboxStore, clock Clock, workers int) *InboxQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &InboxQueue{
+		store:   store,
+		clock:   clock,
+		workers: workers,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Enqueue persists the activity received in the inbox.
+func (q *InboxQueue) Enqueue(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	return q.enqueue(c, inboxIRI, nil, activity)
+}
+
+// EnqueueShared persists the activity received in the shared inbox, which is
+// for the local actors owning the recipient inboxes.
+func (q *InboxQueue) EnqueueShared(c context.Context, sharedInboxIRI *url.URL, recipients []*url.URL, activity Activity) error {
+	return q.enqueue(c, sharedInboxIRI, recipients, activity)
+}
+
+// enqueue persists the activity as a new InboxItem.
+func (q *InboxQueue) enqueue(c context.Context, inboxIRI *url.URL, recipients []*url.URL, activity Activity) error {
+	m, err := streams.Serialize(activity)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	i := &InboxItem{
+		InboxIRI:   inboxIRI,
+		Recipients: recipients,
+		Payload:    b,
+		Received:   q.clock.Now(),
+	}
+	if err := q.store.Enqueue(c, i); err != nil {
+		return err
+	}
+	// Let the background loop know there is new work without blocking.
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start begins processing activities in the background on behalf of the
+// actor, which must have been created by NewActor, NewFederatingActor, or
+// NewCustomActor. It is a no-op if the InboxQueue is already started.
+//
+// The activities are processed with a background context: values added to
+// the request's context, such as by AuthenticatePostInbox, are not available.
+func (q *InboxQueue) Start(actor FederatingActor) error {
+	p, ok := actor.(inboxProcessor)
+	if !ok {
+		return fmt.Errorf("actor of type %T cannot process inbox activities", actor)
+	}
+	q.startMu.Lock()
+	defer q.startMu.Unlock()
+	if q.started {
+		return nil
+	}
+	q.started = true
+	q.processor = p
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go q.loop()
+	return nil
+}
+
+// Stop halts the background processing, waiting for in-flight activities to
+// finish. Unprocessed InboxItems remain in the InboxStore.
+func (q *InboxQueue) Stop() {
+	q.startMu.Lock()
+	defer q.startMu.Unlock()
+	if !q.started {
+		return
+	}
+	close(q.stop)
+	<-q.done
+	q.started = false
+}
+
+// loop processes pending InboxItems until stopped.
+func (q *InboxQueue) loop() {
+	defer close(q.done)
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-q.stop:
+			cancel()
+		case <-c.Done():
+		}
+	}()
+	ticker := time.NewTicker(inboxQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		q.processPending(c)
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processPending processes every pending InboxItem, in batches.
+func (q *InboxQueue) processPending(c context.Context) {
+	for c.Err() == nil {
+		pending, err := q.store.Pending(c, inboxQueueBatchSize)
+		if err != nil || len(pending) == 0 {
+			return
+		}
+		sem := make(chan struct{}, q.workers)
+		var wg sync.WaitGroup
+		for _, i := range pending {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i *InboxItem) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				q.process(c, i)
+			}(i)
+		}
+		wg.Wait()
+		if len(pending) < inboxQueueBatchSize {
+			return
+		}
+	}
+}
+
+// process applies the side effects of a single InboxItem, then removes it.
+func (q *InboxQueue) process(c context.Context, i *InboxItem) {
+	err := q.apply(c, i)
+	if err != nil && c.Err() != nil {
+		// Stopping: leave the InboxItem to be processed later.
+		return
+	}
+	q.store.Remove(c, i)
+	if err != nil && q.OnError != nil {
+		q.OnError(c, i, err)
+	}
+}
+
+// apply deserializes the activity and has the actor process it.
+func (q *InboxQueue) apply(c context.Context, i *InboxItem) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(i.Payload, &m); err != nil {
+		return err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return err
+	}
+	activity, ok := t.(Activity)
+	if !ok {
+		return fmt.Errorf("activity streams value is not an Activity: %T", t)
+	}
+	if len(i.Recipients) > 0 {
+		return q.processor.processSharedInboxItem(c, i.Recipients, activity)
+	}
+	return q.processor.processInboxItem(c, i.InboxIRI, activity)
+}
+
+// InboxQueuer is optionally implemented by a CommonBehavior or a DelegateActor
+// in order to have activities POSTed to inboxes processed asynchronously.
+type InboxQueuer interface {
+	// InboxQueue returns the queue to enqueue received activities in.
+	// Returning nil processes them while handling the request instead.
+	InboxQueue(c context.Context) *InboxQueue
+}
+
+// InboxStore must be implemented by MemoryInboxStore.
+var _ InboxStore = &MemoryInboxStore{}
+
+// MemoryInboxStore is an InboxStore that keeps InboxItems in memory.
+//
+// It is not durable, and is meant for tests and prototypes.
+type MemoryInboxStore struct {
+	mu     sync.Mutex
+	nextId uint64
+	items  map[string]*InboxItem
+}
+
+// NewMemoryInboxStore creates an empty MemoryInboxStore.
+func NewMemoryInboxStore() *MemoryInboxStore {
+	return &MemoryInboxStore{
+		items: make(map[string]*InboxItem),
+	}
+}
+
+// Enqueue stores a copy of the InboxItem.
+func (m *MemoryInboxStore) Enqueue(c context.Context, i *InboxItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextId++
+	i.Id = fmt.Sprintf("%d", m.nextId)
+	cp := *i
+	m.items[i.Id] = &cp
+	return nil
+}
+
+// Pending returns copies of the pending InboxItems, earliest received first.
+func (m *MemoryInboxStore) Pending(c context.Context, max int) ([]*InboxItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := make([]*InboxItem, 0, len(m.items))
+	for _, i := range m.items {
+		cp := *i
+		pending = append(pending, &cp)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Received.Before(pending[j].Received)
+	})
+	if len(pending) > max {
+		pending = pending[:max]
+	}
+	return pending, nil
+}
+
+// Remove deletes the InboxItem.
+func (m *MemoryInboxStore) Remove(c context.Context, i *InboxItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, i.Id)
+	return nil
+}
+
+// Len returns the number of pending InboxItems.
+func (m *MemoryInboxStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
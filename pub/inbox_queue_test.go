@@ -0,0 +1,150 @@
+package pub
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// queuingDelegateActor is a DelegateActor that processes inbox activities
+// through an InboxQueue.
+type queuingDelegateActor struct {
+	*MockDelegateActor
+	q *InboxQueue
+}
+
+func (q *queuingDelegateActor) InboxQueue(c context.Context) *InboxQueue {
+	return q.q
+}
+
+// queuingSharedInboxDelegateActor is a DelegateActor that processes shared
+// inbox activities through an InboxQueue.
+type queuingSharedInboxDelegateActor struct {
+	*sharedInboxDelegateActor
+	q *InboxQueue
+}
+
+func (q *queuingSharedInboxDelegateActor) InboxQueue(c context.Context) *InboxQueue {
+	return q.q
+}
+
+// TestInboxQueue tests asynchronously processing inbox activities.
+func TestInboxQueue(t *testing.T) {
+	const (
+		testMyInboxIRI2    = "https://example.com/sam/inbox"
+		testSharedInboxIRI = "https://example.com/inbox"
+	)
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (s *MemoryInboxStore, delegate *MockDelegateActor, q *InboxQueue, a FederatingActor) {
+		s = NewMemoryInboxStore()
+		delegate = NewMockDelegateActor(ctl)
+		clock := NewMockClock(ctl)
+		clock.EXPECT().Now().Return(now()).AnyTimes()
+		q = NewInboxQueue(s, clock, 2)
+		a = NewCustomActor(
+			&queuingDelegateActor{delegate, q},
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			clock)
+		q.processor = a.(inboxProcessor)
+		return
+	}
+	t.Run("PostInboxEnqueuesAndRespondsAccepted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusAccepted)
+		assertEqual(t, s.Len(), 1)
+	})
+	t.Run("ProcessesEnqueuedActivities", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, delegate, q, _ := setupFn(ctl)
+		q.Enqueue(ctx, mustParse(testMyInboxIRI), testCreate)
+		gomock.InOrder(
+			delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil),
+			delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil),
+		)
+		// Run
+		q.processPending(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 0)
+	})
+	t.Run("ReportsErrorsToHook", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, delegate, q, _ := setupFn(ctl)
+		var gotErr error
+		var gotItem *InboxItem
+		q.OnError = func(c context.Context, i *InboxItem, err error) {
+			gotItem = i
+			gotErr = err
+		}
+		q.Enqueue(ctx, mustParse(testMyInboxIRI), testCreate)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(testErr)
+		// Run
+		q.processPending(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 0)
+		assertEqual(t, gotErr, testErr)
+		assertNotEqual(t, gotItem, nil)
+		assertEqual(t, gotItem.InboxIRI.String(), testMyInboxIRI)
+	})
+	t.Run("PostSharedInboxEnqueuesAndRespondsAccepted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, _, q, _ := setupFn(ctl)
+		delegate := &sharedInboxDelegateActor{
+			MockDelegateActor: NewMockDelegateActor(ctl),
+			inboxes:           []*url.URL{mustParse(testMyInboxIRI), mustParse(testMyInboxIRI2)},
+		}
+		a := NewCustomActor(&queuingSharedInboxDelegateActor{delegate, q}, false, true, NewMockClock(ctl)).(SharedInboxActor)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testListen))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testListen)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testListen)).Return(true, nil)
+		// Run
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusAccepted)
+		assertEqual(t, s.Len(), 1)
+		assertEqual(t, len(delegate.posted), 0)
+	})
+	t.Run("ProcessesSharedInboxActivitiesForEachRecipient", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		s, _, q, _ := setupFn(ctl)
+		delegate := &sharedInboxDelegateActor{MockDelegateActor: NewMockDelegateActor(ctl)}
+		q.processor = NewCustomActor(&queuingSharedInboxDelegateActor{delegate, q}, false, true, NewMockClock(ctl)).(inboxProcessor)
+		inboxes := []*url.URL{mustParse(testMyInboxIRI), mustParse(testMyInboxIRI2)}
+		q.EnqueueShared(ctx, mustParse(testSharedInboxIRI), inboxes, testListen)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testListen)).Return(nil)
+		// Run
+		q.processPending(ctx)
+		// Verify
+		assertEqual(t, s.Len(), 0)
+		assertEqual(t, len(delegate.posted), 2)
+	})
+}
@@ -0,0 +1,120 @@
+package pub
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"github.com/go-fed/httpsig"
+	"net/http"
+	"net/url"
+)
+
+// InstanceActor is an actor representing this server as a whole, rather than
+// any of its users.
+//
+// Peers requiring signed GET requests can then be fetched from for work that is
+// not done on behalf of any user, such as refreshing remote actors, resolving
+// 'inReplyTo' chains, or fetching public keys with an HttpSigVerifier.
+//
+// Its ActivityStreams document is a Service, which is not kept in the
+// Database and is served by the HandlerFunc created by NewHandler.
+type InstanceActor struct {
+	descriptor ActorDescriptor
+	outbox     *url.URL
+	key        crypto.Signer
+}
+
+// NewInstanceActor creates an InstanceActor with the IRI, which signs requests
+// with the key.
+//
+// The inbox and outbox are required for its document to be a valid actor, but
+// handling requests to them is left to the application. The key, such as an
+// *rsa.PrivateKey, must be kept by the application so the same key is used
+// every time.
+func NewInstanceActor(id, inbox, outbox *url.URL, preferredUsername string, key crypto.Signer) *InstanceActor {
+	keyId := *id
+	keyId.Fragment = defaultPublicKeyFragment
+	return &InstanceActor{
+		descriptor: ActorDescriptor{
+			Type:              "Service",
+			Id:                id,
+			Inbox:             inbox,
+			PreferredUsername: preferredUsername,
+			PublicKey:         key.Public(),
+			PublicKeyId:       &keyId,
+		},
+		outbox: outbox,
+		key:    key,
+	}
+}
+
+// Id returns the IRI of the InstanceActor.
+func (i *InstanceActor) Id() *url.URL {
+	return i.descriptor.Id
+}
+
+// PublicKeyId returns the IRI of the InstanceActor's public key, which is its
+// IRI with a "main-key" fragment.
+func (i *InstanceActor) PublicKeyId() *url.URL {
+	return i.descriptor.PublicKeyId
+}
+
+// Document builds the serialized ActivityStreams document of the
+// InstanceActor, including its 'publicKey'.
+func (i *InstanceActor) Document() (map[string]interface{}, error) {
+	return toActorDocument(&i.descriptor, i.outbox)
+}
+
+// NewHandler creates a HandlerFunc that serves the InstanceActor's document.
+//
+// Requests for other IRIs are not handled, so the caller may continue with
+// another HandlerFunc.
+func (i *InstanceActor) NewHandler(clock Clock) HandlerFunc {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not an ActivityPub GET request for
+		// the InstanceActor.
+		if !isActivityPubGet(r) || requestId(r).String() != i.Id().String() {
+			return
+		}
+		isASRequest = true
+		m, err := i.Document()
+		if err != nil {
+			return
+		}
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return
+		}
+		// Construct the response.
+		addResponseHeaders(w.Header(), clock, raw)
+		addCachingHeaders(c, w.Header(), nil, nil, raw)
+		// Write the response, unless the requester has it already.
+		if isNotModified(r, w.Header()) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		n, err := w.Write(raw)
+		if err != nil {
+			return
+		} else if n != len(raw) {
+			err = fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+			return
+		}
+		return
+	}
+}
+
+// NewTransport creates an HttpSigTransport that signs its requests as the
+// InstanceActor.
+//
+// It is meant for Dereference calls that are not made on behalf of any user.
+// See NewHttpSigTransport for the other parameters.
+func (i *InstanceActor) NewTransport(
+	client HttpClient,
+	appAgent string,
+	clock Clock,
+	getSigner, postSigner httpsig.Signer) *HttpSigTransport {
+	return NewHttpSigTransport(client, appAgent, clock, getSigner, postSigner, i.PublicKeyId().String(), i.key)
+}
@@ -0,0 +1,108 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/go-fed/httpsig"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordingClient is an HttpClient that records the last request made.
+type recordingClient struct {
+	req *http.Request
+}
+
+func (r *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	r.req = req
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     http.StatusText(http.StatusOK),
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}, nil
+}
+
+// TestInstanceActor tests serving and signing as the InstanceActor.
+func TestInstanceActor(t *testing.T) {
+	const (
+		testInstanceIRI       = "https://example.com/actor"
+		testInstanceInboxIRI  = "https://example.com/actor/inbox"
+		testInstanceOutboxIRI = "https://example.com/actor/outbox"
+	)
+	ctx := context.Background()
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ia := NewInstanceActor(
+		mustParse(testInstanceIRI),
+		mustParse(testInstanceInboxIRI),
+		mustParse(testInstanceOutboxIRI),
+		"example.com",
+		priv)
+	t.Run("ServesServiceDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		h := ia.NewHandler(c)
+		resp := httptest.NewRecorder()
+		// Run
+		handled, err := h(ctx, resp, toAPRequest(httptest.NewRequest("GET", testInstanceIRI, nil)))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		var m map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, m["type"], "Service")
+		assertEqual(t, m["id"], testInstanceIRI)
+		assertEqual(t, m["inbox"], testInstanceInboxIRI)
+		assertEqual(t, m["outbox"], testInstanceOutboxIRI)
+		assertEqual(t, m["publicKey"].(map[string]interface{})["id"], testInstanceIRI+"#main-key")
+	})
+	t.Run("IgnoresOtherIRIs", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h := ia.NewHandler(NewMockClock(ctl))
+		// Run
+		handled, err := h(ctx, httptest.NewRecorder(), toAPRequest(httptest.NewRequest("GET", testPersonIRI, nil)))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+	t.Run("SignsDereferences", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		signer, _, err := httpsig.NewSigner(
+			[]httpsig.Algorithm{httpsig.RSA_SHA256},
+			httpsig.DigestSha256,
+			[]string{requestTargetHeader, "date"},
+			httpsig.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &recordingClient{}
+		tp := ia.NewTransport(client, "test", c, signer, signer)
+		// Run
+		_, err = tp.Dereference(ctx, mustParse(testFederatedActorIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		sig := client.req.Header.Get(signatureHeader)
+		assertEqual(t, strings.Contains(sig, `keyId="`+testInstanceIRI+`#main-key"`), true)
+	})
+}
@@ -0,0 +1,557 @@
+// Package memdb provides a concurrency-safe, in-memory implementation of the
+// pub.Database interface.
+//
+// It is intended for prototyping, integration testing, and as an executable
+// specification of the behaviors the pub library expects of a Database. All
+// data is lost when the process exits.
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Database must satisfy the pub.Database interface.
+var _ pub.Database = &Database{}
+
+// Database must satisfy the pub.LocalFollowersDatabase interface.
+var _ pub.LocalFollowersDatabase = &Database{}
+
+// Database must satisfy the pub.AppendCollectionDatabase interface.
+var _ pub.AppendCollectionDatabase = &Database{}
+
+// Database must satisfy the pub.PendingFollowsDatabase interface.
+var _ pub.PendingFollowsDatabase = &Database{}
+
+// pageSize is the number of items on a page of an inbox or outbox, unless
+// the page request is limited to another number of items.
+const pageSize = pub.DefaultPageSize
+
+// actorRecord tracks the IRIs associated with a single local actor.
+type actorRecord struct {
+	id        *url.URL
+	inbox     *url.URL
+	outbox    *url.URL
+	followers *url.URL
+	following *url.URL
+	liked     *url.URL
+}
+
+// refLock is a mutex that tracks the number of goroutines holding or waiting
+// on it, so it can be removed once nobody needs it anymore.
+type refLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Database is an in-memory pub.Database.
+//
+// Values are stored in their serialized form and deserialized on every read,
+// so callers are free to modify the values they obtain without affecting the
+// stored copy until they call Update.
+//
+// The zero value is not usable, use New instead.
+type Database struct {
+	// host is the scheme and host this database mints and owns ids for.
+	host *url.URL
+	// locksMu guards locks.
+	locksMu sync.Mutex
+	// locks contains the per-IRI locks taken by the pub library.
+	locks map[string]*refLock
+	// mu guards all fields below it.
+	mu sync.RWMutex
+	// entries maps an id to its serialized ActivityStreams value.
+	entries map[string]map[string]interface{}
+	// boxes maps an inbox or outbox IRI to its ordered item ids, newest
+	// first.
+	boxes map[string][]*url.URL
+	// actors maps an actor's id to its record.
+	actors map[string]*actorRecord
+	// inboxes maps an inbox IRI to the actor owning it.
+	inboxes map[string]*actorRecord
+	// outboxes maps an outbox IRI to the actor owning it.
+	outboxes map[string]*actorRecord
+	// pendingFollows maps an actor's id to its serialized Follows awaiting
+	// approval, oldest first.
+	pendingFollows map[string][]map[string]interface{}
+	// nextId is the counter used when minting new ids.
+	nextId uint64
+}
+
+// New creates an empty in-memory Database.
+//
+// The host determines which IRIs are owned by this database and is used as
+// the base when minting new ids, for example "https://example.com".
+func New(host *url.URL) *Database {
+	h := &url.URL{
+		Scheme: host.Scheme,
+		Host:   host.Host,
+	}
+	return &Database{
+		host:           h,
+		locks:          make(map[string]*refLock),
+		entries:        make(map[string]map[string]interface{}),
+		boxes:          make(map[string][]*url.URL),
+		actors:         make(map[string]*actorRecord),
+		inboxes:        make(map[string]*actorRecord),
+		outboxes:       make(map[string]*actorRecord),
+		pendingFollows: make(map[string][]map[string]interface{}),
+	}
+}
+
+// Lock takes a lock for the object at the specified id, blocking until it is
+// available.
+func (d *Database) Lock(c context.Context, id *url.URL) error {
+	k := id.String()
+	d.locksMu.Lock()
+	l, ok := d.locks[k]
+	if !ok {
+		l = &refLock{}
+		d.locks[k] = l
+	}
+	l.refs++
+	d.locksMu.Unlock()
+	l.mu.Lock()
+	return nil
+}
+
+// Unlock makes the lock for the object at the specified id available.
+func (d *Database) Unlock(c context.Context, id *url.URL) error {
+	k := id.String()
+	d.locksMu.Lock()
+	defer d.locksMu.Unlock()
+	l, ok := d.locks[k]
+	if !ok {
+		return fmt.Errorf("memdb: unlock of unlocked id %s", k)
+	}
+	l.refs--
+	if l.refs == 0 {
+		delete(d.locks, k)
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// InboxContains returns true if the inbox contains the specified id.
+func (d *Database) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if _, ok := d.inboxes[inbox.String()]; !ok {
+		return false, fmt.Errorf("memdb: no inbox %s", inbox)
+	}
+	return containsIRI(d.boxes[inbox.String()], id), nil
+}
+
+// GetInbox returns the inbox as a single OrderedCollectionPage with every
+// item in it.
+func (d *Database) GetInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if _, ok := d.inboxes[inboxIRI.String()]; !ok {
+		return nil, fmt.Errorf("memdb: no inbox %s", inboxIRI)
+	}
+	return toPage(inboxIRI, d.boxes[inboxIRI.String()]), nil
+}
+
+// SetInbox replaces the items of the inbox identified by the page's id.
+func (d *Database) SetInbox(c context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	return d.setBox(inbox, d.inboxes)
+}
+
+// Owns returns true if the id exists in the database and its host is the one
+// this database was created with.
+func (d *Database) Owns(c context.Context, id *url.URL) (owns bool, err error) {
+	if id.Scheme != d.host.Scheme || id.Host != d.host.Host {
+		return false, nil
+	}
+	return d.Exists(c, id)
+}
+
+// ActorForOutbox fetches the actor's IRI for the given outbox IRI.
+func (d *Database) ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	a, ok := d.outboxes[outboxIRI.String()]
+	if !ok {
+		return nil, fmt.Errorf("memdb: no actor for outbox %s", outboxIRI)
+	}
+	return a.id, nil
+}
+
+// ActorForInbox fetches the actor's IRI for the given inbox IRI.
+func (d *Database) ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	a, ok := d.inboxes[inboxIRI.String()]
+	if !ok {
+		return nil, fmt.Errorf("memdb: no actor for inbox %s", inboxIRI)
+	}
+	return a.id, nil
+}
+
+// OutboxForInbox fetches the corresponding actor's outbox IRI for the actor's
+// inbox IRI.
+func (d *Database) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	a, ok := d.inboxes[inboxIRI.String()]
+	if !ok {
+		return nil, fmt.Errorf("memdb: no actor for inbox %s", inboxIRI)
+	}
+	return a.outbox, nil
+}
+
+// Exists returns true if the database has an entry for the specified id.
+func (d *Database) Exists(c context.Context, id *url.URL) (exists bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, exists = d.entries[id.String()]
+	return
+}
+
+// Get returns the database entry for the specified id.
+func (d *Database) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
+	d.mu.RLock()
+	m, ok := d.entries[id.String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("memdb: no entry for %s", id)
+	}
+	return streams.ToType(c, copyMap(m))
+}
+
+// Create adds a new entry to the database keyed by its id.
+//
+// Creating an entry that already exists overwrites it, as the pub library may
+// call Create more than once for the same value.
+func (d *Database) Create(c context.Context, asType vocab.Type) error {
+	return d.put(asType)
+}
+
+// Update sets an existing entry to the database based on the value's id.
+func (d *Database) Update(c context.Context, asType vocab.Type) error {
+	return d.put(asType)
+}
+
+// Delete removes the entry with the given id.
+func (d *Database) Delete(c context.Context, id *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, id.String())
+	return nil
+}
+
+// GetOutbox returns the outbox as a single OrderedCollectionPage with every
+// item in it.
+func (d *Database) GetOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if _, ok := d.outboxes[outboxIRI.String()]; !ok {
+		return nil, fmt.Errorf("memdb: no outbox %s", outboxIRI)
+	}
+	return toPage(outboxIRI, d.boxes[outboxIRI.String()]), nil
+}
+
+// SetOutbox replaces the items of the outbox identified by the page's id.
+func (d *Database) SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	return d.setBox(outbox, d.outboxes)
+}
+
+// NewId mints a new IRI on this database's host. The value's type name is
+// used as part of the path, for example "https://example.com/note/3".
+func (d *Database) NewId(c context.Context, t vocab.Type) (id *url.URL, err error) {
+	d.mu.Lock()
+	d.nextId++
+	n := d.nextId
+	d.mu.Unlock()
+	id = &url.URL{
+		Scheme: d.host.Scheme,
+		Host:   d.host.Host,
+		Path:   fmt.Sprintf("/%s/%d", strings.ToLower(t.GetTypeName()), n),
+	}
+	return
+}
+
+// Followers obtains the followers Collection of a local actor.
+func (d *Database) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, func(a *actorRecord) *url.URL { return a.followers })
+}
+
+// Following obtains the following Collection of a local actor.
+func (d *Database) Following(c context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, func(a *actorRecord) *url.URL { return a.following })
+}
+
+// Liked obtains the liked Collection of a local actor.
+func (d *Database) Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, func(a *actorRecord) *url.URL { return a.liked })
+}
+
+// LocalFollowers returns the ids of local actors whose following Collection
+// contains the actor.
+func (d *Database) LocalFollowers(c context.Context, actorIRI *url.URL) (followers []*url.URL, err error) {
+	d.mu.RLock()
+	recs := make([]*actorRecord, 0, len(d.actors))
+	for _, rec := range d.actors {
+		if rec.following != nil {
+			recs = append(recs, rec)
+		}
+	}
+	d.mu.RUnlock()
+	for _, rec := range recs {
+		var following vocab.ActivityStreamsCollection
+		following, err = d.Following(c, rec.id)
+		if err != nil {
+			return
+		}
+		items := following.GetActivityStreamsItems()
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = toId(iter)
+			if err != nil {
+				return
+			}
+			if id.String() == actorIRI.String() {
+				followers = append(followers, rec.id)
+				break
+			}
+		}
+	}
+	return
+}
+
+// AppendInbox adds the id as the newest item of the inbox.
+func (d *Database) AppendInbox(c context.Context, inboxIRI, id *url.URL) error {
+	return d.appendBox(inboxIRI, id, d.inboxes)
+}
+
+// AppendOutbox adds the id as the newest item of the outbox.
+func (d *Database) AppendOutbox(c context.Context, outboxIRI, id *url.URL) error {
+	return d.appendBox(outboxIRI, id, d.outboxes)
+}
+
+// InboxItems returns a page of at most 20 items of the inbox.
+func (d *Database) InboxItems(c context.Context, inboxIRI *url.URL, page pub.PageRequest) (items []*url.URL, totalItems int, err error) {
+	return d.boxItems(inboxIRI, page, d.inboxes)
+}
+
+// OutboxItems returns a page of at most 20 items of the outbox.
+func (d *Database) OutboxItems(c context.Context, outboxIRI *url.URL, page pub.PageRequest) (items []*url.URL, totalItems int, err error) {
+	return d.boxItems(outboxIRI, page, d.outboxes)
+}
+
+// AddPendingFollow records the Follow as awaiting approval by the actor.
+func (d *Database) AddPendingFollow(c context.Context, actorIRI *url.URL, follow vocab.ActivityStreamsFollow) error {
+	m, err := streams.Serialize(follow)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pendingFollows[actorIRI.String()] = append(d.pendingFollows[actorIRI.String()], m)
+	return nil
+}
+
+// PendingFollows returns the Follows awaiting approval by the actor.
+func (d *Database) PendingFollows(c context.Context, actorIRI *url.URL) (follows []vocab.ActivityStreamsFollow, err error) {
+	d.mu.RLock()
+	pending := d.pendingFollows[actorIRI.String()]
+	ms := make([]map[string]interface{}, len(pending))
+	for i, m := range pending {
+		ms[i] = copyMap(m)
+	}
+	d.mu.RUnlock()
+	for _, m := range ms {
+		var follow vocab.ActivityStreamsFollow
+		follow, err = toFollow(c, m)
+		if err != nil {
+			return
+		}
+		follows = append(follows, follow)
+	}
+	return
+}
+
+// RemovePendingFollow removes and returns the Follow with the id awaiting
+// approval by the actor.
+func (d *Database) RemovePendingFollow(c context.Context, actorIRI, followIRI *url.URL) (follow vocab.ActivityStreamsFollow, err error) {
+	d.mu.Lock()
+	pending := d.pendingFollows[actorIRI.String()]
+	var m map[string]interface{}
+	for i, p := range pending {
+		if id, ok := p["id"].(string); ok && id == followIRI.String() {
+			m = p
+			d.pendingFollows[actorIRI.String()] = append(pending[:i:i], pending[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+	if m == nil {
+		return nil, nil
+	}
+	return toFollow(c, m)
+}
+
+// CreateActor registers a local actor and stores it as an entry.
+//
+// The actor must have an 'id', 'inbox', and 'outbox'. Empty inbox and outbox
+// OrderedCollections are set up for it, as well as empty Collections for any
+// of its 'followers', 'following', and 'liked' properties that are set.
+func (d *Database) CreateActor(c context.Context, actor vocab.Type) error {
+	rec, err := toActorRecord(actor)
+	if err != nil {
+		return err
+	}
+	if err = d.put(actor); err != nil {
+		return err
+	}
+	for _, iri := range []*url.URL{rec.followers, rec.following, rec.liked} {
+		if iri == nil {
+			continue
+		}
+		if err = d.put(newCollection(iri)); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.actors[rec.id.String()] = rec
+	d.inboxes[rec.inbox.String()] = rec
+	d.outboxes[rec.outbox.String()] = rec
+	if _, ok := d.boxes[rec.inbox.String()]; !ok {
+		d.boxes[rec.inbox.String()] = nil
+	}
+	if _, ok := d.boxes[rec.outbox.String()]; !ok {
+		d.boxes[rec.outbox.String()] = nil
+	}
+	return nil
+}
+
+// put stores the serialized value keyed by its id.
+func (d *Database) put(t vocab.Type) error {
+	id := t.GetJSONLDId()
+	if id == nil || id.Get() == nil {
+		return fmt.Errorf("memdb: cannot store %s without an id", t.GetTypeName())
+	}
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[id.Get().String()] = m
+	return nil
+}
+
+// setBox replaces the items of an inbox or outbox with those on the page.
+func (d *Database) setBox(page vocab.ActivityStreamsOrderedCollectionPage, owners map[string]*actorRecord) error {
+	id := page.GetJSONLDId()
+	if id == nil || id.Get() == nil {
+		return fmt.Errorf("memdb: cannot set box without an id")
+	}
+	var items []*url.URL
+	if oi := page.GetActivityStreamsOrderedItems(); oi != nil {
+		for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+			iri, err := toId(iter)
+			if err != nil {
+				return err
+			}
+			items = append(items, iri)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := id.Get().String()
+	if _, ok := owners[k]; !ok {
+		return fmt.Errorf("memdb: no box %s", k)
+	}
+	d.boxes[k] = items
+	return nil
+}
+
+// appendBox prepends the id to the items of an inbox or outbox.
+func (d *Database) appendBox(boxIRI, id *url.URL, owners map[string]*actorRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := boxIRI.String()
+	if _, ok := owners[k]; !ok {
+		return fmt.Errorf("memdb: no box %s", k)
+	}
+	d.boxes[k] = append([]*url.URL{id}, d.boxes[k]...)
+	return nil
+}
+
+// boxItems returns the items on a page of an inbox or outbox.
+//
+// A page requested with a max_id contains the items immediately after it, and
+// a page requested with a min_id contains the items immediately before it. An
+// unknown max_id or min_id results in an empty page.
+func (d *Database) boxItems(boxIRI *url.URL, page pub.PageRequest, owners map[string]*actorRecord) (items []*url.URL, totalItems int, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	k := boxIRI.String()
+	if _, ok := owners[k]; !ok {
+		return nil, 0, fmt.Errorf("memdb: no box %s", k)
+	}
+	all := d.boxes[k]
+	totalItems = len(all)
+	limit := pageSize
+	if page.Limit > 0 {
+		limit = page.Limit
+	}
+	start, end := 0, len(all)
+	if len(page.MaxId) > 0 {
+		start = indexOfIRI(all, page.MaxId) + 1
+		if start == 0 {
+			return nil, totalItems, nil
+		}
+	}
+	if len(page.MinId) > 0 {
+		end = indexOfIRI(all, page.MinId)
+		if end < 0 {
+			return nil, totalItems, nil
+		}
+		if len(page.MaxId) == 0 && end-limit > start {
+			start = end - limit
+		}
+	}
+	if end-start > limit {
+		end = start + limit
+	}
+	if start < end {
+		items = append(items, all[start:end]...)
+	}
+	return
+}
+
+// actorCollection fetches one of a local actor's collections.
+func (d *Database) actorCollection(c context.Context, actorIRI *url.URL, fn func(*actorRecord) *url.URL) (vocab.ActivityStreamsCollection, error) {
+	d.mu.RLock()
+	a, ok := d.actors[actorIRI.String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("memdb: no actor %s", actorIRI)
+	}
+	iri := fn(a)
+	if iri == nil {
+		return nil, fmt.Errorf("memdb: actor %s does not have this collection", actorIRI)
+	}
+	t, err := d.Get(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	col, ok := t.(vocab.ActivityStreamsCollection)
+	if !ok {
+		return nil, fmt.Errorf("memdb: %s is not a Collection: %T", iri, t)
+	}
+	if col.GetActivityStreamsItems() == nil {
+		col.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+	}
+	return col, nil
+}
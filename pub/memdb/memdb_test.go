@@ -0,0 +1,352 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+const (
+	testHost         = "https://example.com"
+	testActorIRI     = "https://example.com/addison"
+	testInboxIRI     = "https://example.com/addison/inbox"
+	testOutboxIRI    = "https://example.com/addison/outbox"
+	testFollowersIRI = "https://example.com/addison/followers"
+	testFollowingIRI = "https://example.com/addison/following"
+	testNoteIRI      = "https://example.com/note/1"
+	testRemoteIRI    = "https://other.example.com/activity/1"
+	testRemoteIRI2   = "https://other.example.com/activity/2"
+	testRemoteActor  = "https://other.example.com/dakota"
+)
+
+// mustParse parses a URL or panics.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// newTestDatabase creates a Database with a single registered actor.
+func newTestDatabase(t *testing.T) *Database {
+	db := New(mustParse(testHost))
+	person := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testActorIRI))
+	person.SetJSONLDId(id)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(mustParse(testInboxIRI))
+	person.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(mustParse(testOutboxIRI))
+	person.SetActivityStreamsOutbox(outbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(mustParse(testFollowersIRI))
+	person.SetActivityStreamsFollowers(followers)
+	following := streams.NewActivityStreamsFollowingProperty()
+	following.SetIRI(mustParse(testFollowingIRI))
+	person.SetActivityStreamsFollowing(following)
+	if err := db.CreateActor(context.Background(), person); err != nil {
+		t.Fatalf("CreateActor: %s", err)
+	}
+	return db
+}
+
+// newTestNote creates a Note with the given id.
+func newTestNote(iri string) vocab.ActivityStreamsNote {
+	note := streams.NewActivityStreamsNote()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(iri))
+	note.SetJSONLDId(id)
+	content := streams.NewActivityStreamsContentProperty()
+	content.AppendXMLSchemaString("hello")
+	note.SetActivityStreamsContent(content)
+	return note
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	t.Run("SerializesAccessPerIRI", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		iri := mustParse(testNoteIRI)
+		var wg sync.WaitGroup
+		counter := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				db.Lock(ctx, iri)
+				counter++
+				db.Unlock(ctx, iri)
+			}()
+		}
+		wg.Wait()
+		if counter != 50 {
+			t.Fatalf("expected 50, got %d", counter)
+		}
+		if len(db.locks) != 0 {
+			t.Fatalf("expected no remaining locks, got %d", len(db.locks))
+		}
+	})
+	t.Run("ErrorsUnlockingUnlockedIRI", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		if err := db.Unlock(ctx, mustParse(testNoteIRI)); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestEntries(t *testing.T) {
+	ctx := context.Background()
+	t.Run("CreateThenGet", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		if err := db.Create(ctx, newTestNote(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		v, err := db.Get(ctx, mustParse(testNoteIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := v.(vocab.ActivityStreamsNote); !ok {
+			t.Fatalf("expected Note, got %T", v)
+		}
+	})
+	t.Run("GetValuesAreNotAliased", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		db.Create(ctx, newTestNote(testNoteIRI))
+		v, _ := db.Get(ctx, mustParse(testNoteIRI))
+		v.(vocab.ActivityStreamsNote).SetActivityStreamsContent(nil)
+		v, _ = db.Get(ctx, mustParse(testNoteIRI))
+		if v.(vocab.ActivityStreamsNote).GetActivityStreamsContent() == nil {
+			t.Fatalf("stored value was modified")
+		}
+	})
+	t.Run("CreateRequiresId", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		if err := db.Create(ctx, streams.NewActivityStreamsNote()); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+	t.Run("DeleteRemovesEntry", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		db.Create(ctx, newTestNote(testNoteIRI))
+		db.Delete(ctx, mustParse(testNoteIRI))
+		if exists, _ := db.Exists(ctx, mustParse(testNoteIRI)); exists {
+			t.Fatalf("expected entry to be deleted")
+		}
+	})
+	t.Run("OwnsOnlyLocalEntries", func(t *testing.T) {
+		db := New(mustParse(testHost))
+		db.Create(ctx, newTestNote(testNoteIRI))
+		db.Create(ctx, newTestNote(testRemoteIRI))
+		if owns, _ := db.Owns(ctx, mustParse(testNoteIRI)); !owns {
+			t.Fatalf("expected to own local entry")
+		}
+		if owns, _ := db.Owns(ctx, mustParse(testRemoteIRI)); owns {
+			t.Fatalf("expected not to own remote entry")
+		}
+		if exists, _ := db.Exists(ctx, mustParse(testRemoteIRI)); !exists {
+			t.Fatalf("expected remote entry to exist")
+		}
+	})
+}
+
+func TestBoxes(t *testing.T) {
+	ctx := context.Background()
+	t.Run("InboxPrependsAndContains", func(t *testing.T) {
+		db := newTestDatabase(t)
+		inboxIRI := mustParse(testInboxIRI)
+		for _, iri := range []string{testRemoteIRI, testRemoteIRI2} {
+			inbox, err := db.GetInbox(ctx, inboxIRI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inbox.GetActivityStreamsOrderedItems().PrependIRI(mustParse(iri))
+			if err = db.SetInbox(ctx, inbox); err != nil {
+				t.Fatal(err)
+			}
+		}
+		inbox, _ := db.GetInbox(ctx, inboxIRI)
+		oi := inbox.GetActivityStreamsOrderedItems()
+		if oi.Len() != 2 {
+			t.Fatalf("expected 2 items, got %d", oi.Len())
+		}
+		if oi.At(0).GetIRI().String() != testRemoteIRI2 {
+			t.Fatalf("expected newest item first, got %s", oi.At(0).GetIRI())
+		}
+		if contains, _ := db.InboxContains(ctx, inboxIRI, mustParse(testRemoteIRI)); !contains {
+			t.Fatalf("expected inbox to contain item")
+		}
+		if contains, _ := db.InboxContains(ctx, inboxIRI, mustParse(testNoteIRI)); contains {
+			t.Fatalf("expected inbox to not contain item")
+		}
+	})
+	t.Run("OutboxIsSeparateFromInbox", func(t *testing.T) {
+		db := newTestDatabase(t)
+		outbox, err := db.GetOutbox(ctx, mustParse(testOutboxIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outbox.GetActivityStreamsOrderedItems().PrependIRI(mustParse(testNoteIRI))
+		if err = db.SetOutbox(ctx, outbox); err != nil {
+			t.Fatal(err)
+		}
+		inbox, _ := db.GetInbox(ctx, mustParse(testInboxIRI))
+		if n := inbox.GetActivityStreamsOrderedItems().Len(); n != 0 {
+			t.Fatalf("expected empty inbox, got %d", n)
+		}
+	})
+	t.Run("UnknownBoxErrors", func(t *testing.T) {
+		db := newTestDatabase(t)
+		if _, err := db.GetInbox(ctx, mustParse(testOutboxIRI)); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+	t.Run("AppendedItemsArePaged", func(t *testing.T) {
+		db := newTestDatabase(t)
+		outboxIRI := mustParse(testOutboxIRI)
+		for i := 0; i < pageSize+5; i++ {
+			if err := db.AppendOutbox(ctx, outboxIRI, mustParse(fmt.Sprintf("%s/note/%d", testHost, i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		first, total, err := db.OutboxItems(ctx, outboxIRI, pub.PageRequest{Page: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != pageSize+5 || len(first) != pageSize {
+			t.Fatalf("expected %d of %d items, got %d of %d", pageSize, pageSize+5, len(first), total)
+		}
+		if first[0].String() != testHost+"/note/24" {
+			t.Fatalf("expected newest item first, got %s", first[0])
+		}
+		next, _, _ := db.OutboxItems(ctx, outboxIRI, pub.PageRequest{Page: true, MaxId: first[len(first)-1].String()})
+		if len(next) != 5 || next[0].String() != testHost+"/note/4" {
+			t.Fatalf("expected the 5 oldest items, got %v", next)
+		}
+		prev, _, _ := db.OutboxItems(ctx, outboxIRI, pub.PageRequest{Page: true, MinId: next[0].String()})
+		if len(prev) != pageSize || prev[pageSize-1].String() != first[pageSize-1].String() {
+			t.Fatalf("expected the first page, got %v", prev)
+		}
+	})
+}
+
+func TestActors(t *testing.T) {
+	ctx := context.Background()
+	t.Run("MapsBoxesToActor", func(t *testing.T) {
+		db := newTestDatabase(t)
+		a, err := db.ActorForInbox(ctx, mustParse(testInboxIRI))
+		if err != nil || a.String() != testActorIRI {
+			t.Fatalf("ActorForInbox: %v %v", a, err)
+		}
+		a, err = db.ActorForOutbox(ctx, mustParse(testOutboxIRI))
+		if err != nil || a.String() != testActorIRI {
+			t.Fatalf("ActorForOutbox: %v %v", a, err)
+		}
+		o, err := db.OutboxForInbox(ctx, mustParse(testInboxIRI))
+		if err != nil || o.String() != testOutboxIRI {
+			t.Fatalf("OutboxForInbox: %v %v", o, err)
+		}
+	})
+	t.Run("FollowersUpdateRoundTrips", func(t *testing.T) {
+		db := newTestDatabase(t)
+		followers, err := db.Followers(ctx, mustParse(testActorIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		followers.GetActivityStreamsItems().PrependIRI(mustParse(testRemoteIRI))
+		if err = db.Update(ctx, followers); err != nil {
+			t.Fatal(err)
+		}
+		followers, _ = db.Followers(ctx, mustParse(testActorIRI))
+		if n := followers.GetActivityStreamsItems().Len(); n != 1 {
+			t.Fatalf("expected 1 follower, got %d", n)
+		}
+	})
+	t.Run("LocalFollowersOfPeer", func(t *testing.T) {
+		db := newTestDatabase(t)
+		following, _ := db.Following(ctx, mustParse(testActorIRI))
+		following.GetActivityStreamsItems().AppendIRI(mustParse(testRemoteActor))
+		if err := db.Update(ctx, following); err != nil {
+			t.Fatal(err)
+		}
+		followers, err := db.LocalFollowers(ctx, mustParse(testRemoteActor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(followers) != 1 || followers[0].String() != testActorIRI {
+			t.Fatalf("expected local follower %s, got %v", testActorIRI, followers)
+		}
+		followers, _ = db.LocalFollowers(ctx, mustParse(testActorIRI))
+		if len(followers) != 0 {
+			t.Fatalf("expected no local followers, got %v", followers)
+		}
+	})
+	t.Run("MissingCollectionErrors", func(t *testing.T) {
+		db := newTestDatabase(t)
+		if _, err := db.Liked(ctx, mustParse(testActorIRI)); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestPendingFollows(t *testing.T) {
+	ctx := context.Background()
+	newFollow := func(iri string) vocab.ActivityStreamsFollow {
+		follow := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(iri))
+		follow.SetJSONLDId(id)
+		return follow
+	}
+	t.Run("AddListAndRemove", func(t *testing.T) {
+		db := newTestDatabase(t)
+		actor := mustParse(testActorIRI)
+		for _, iri := range []string{testRemoteIRI, testRemoteIRI2} {
+			if err := db.AddPendingFollow(ctx, actor, newFollow(iri)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		follows, err := db.PendingFollows(ctx, actor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(follows) != 2 || follows[0].GetJSONLDId().Get().String() != testRemoteIRI {
+			t.Fatalf("expected 2 pending follows, oldest first, got %v", follows)
+		}
+		follow, err := db.RemovePendingFollow(ctx, actor, mustParse(testRemoteIRI))
+		if err != nil || follow == nil || follow.GetJSONLDId().Get().String() != testRemoteIRI {
+			t.Fatalf("RemovePendingFollow: %v %v", follow, err)
+		}
+		follows, _ = db.PendingFollows(ctx, actor)
+		if len(follows) != 1 || follows[0].GetJSONLDId().Get().String() != testRemoteIRI2 {
+			t.Fatalf("expected remaining follow %s, got %v", testRemoteIRI2, follows)
+		}
+	})
+	t.Run("RemoveMissingReturnsNil", func(t *testing.T) {
+		db := newTestDatabase(t)
+		follow, err := db.RemovePendingFollow(ctx, mustParse(testActorIRI), mustParse(testRemoteIRI))
+		if err != nil || follow != nil {
+			t.Fatalf("expected no follow, got %v %v", follow, err)
+		}
+	})
+}
+
+func TestNewId(t *testing.T) {
+	ctx := context.Background()
+	db := New(mustParse(testHost))
+	a, _ := db.NewId(ctx, streams.NewActivityStreamsNote())
+	b, _ := db.NewId(ctx, streams.NewActivityStreamsNote())
+	if a.String() == b.String() {
+		t.Fatalf("expected unique ids, got %s twice", a)
+	}
+	if a.Host != "example.com" || a.Path != "/note/1" {
+		t.Fatalf("unexpected id %s", a)
+	}
+}
@@ -0,0 +1,173 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
+)
+
+// idProperty is a property value that may be an IRI or an embedded type.
+type idProperty interface {
+	GetIRI() *url.URL
+	GetType() vocab.Type
+	IsIRI() bool
+}
+
+// toId returns the id of a property value.
+func toId(i idProperty) (*url.URL, error) {
+	if t := i.GetType(); t != nil {
+		if id := t.GetJSONLDId(); id != nil {
+			return id.Get(), nil
+		}
+		return nil, fmt.Errorf("memdb: embedded %s has no id", t.GetTypeName())
+	} else if i.IsIRI() {
+		return i.GetIRI(), nil
+	}
+	return nil, fmt.Errorf("memdb: cannot determine id of property value")
+}
+
+// containsIRI returns true if the IRI is in the list.
+func containsIRI(l []*url.URL, iri *url.URL) bool {
+	s := iri.String()
+	for _, elem := range l {
+		if elem.String() == s {
+			return true
+		}
+	}
+	return false
+}
+
+// indexOfIRI returns the index of the IRI in the list, or -1 if absent.
+func indexOfIRI(l []*url.URL, iri string) int {
+	for i, elem := range l {
+		if elem.String() == iri {
+			return i
+		}
+	}
+	return -1
+}
+
+// toPage builds an OrderedCollectionPage with the given id and items.
+func toPage(id *url.URL, items []*url.URL) vocab.ActivityStreamsOrderedCollectionPage {
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(id)
+	page.SetJSONLDId(idProp)
+	oi := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range items {
+		oi.AppendIRI(item)
+	}
+	page.SetActivityStreamsOrderedItems(oi)
+	return page
+}
+
+// newCollection builds an empty Collection with the given id.
+func newCollection(id *url.URL) vocab.ActivityStreamsCollection {
+	col := streams.NewActivityStreamsCollection()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(id)
+	col.SetJSONLDId(idProp)
+	col.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+	return col
+}
+
+// Interfaces for the actor properties needed to register an actor.
+type (
+	inboxer interface {
+		GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
+	}
+	outboxer interface {
+		GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+	}
+	followerser interface {
+		GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+	}
+	followinger interface {
+		GetActivityStreamsFollowing() vocab.ActivityStreamsFollowingProperty
+	}
+	likeder interface {
+		GetActivityStreamsLiked() vocab.ActivityStreamsLikedProperty
+	}
+)
+
+// toActorRecord extracts the IRIs of an actor needed to serve it.
+func toActorRecord(actor vocab.Type) (rec *actorRecord, err error) {
+	rec = &actorRecord{}
+	if id := actor.GetJSONLDId(); id != nil {
+		rec.id = id.Get()
+	}
+	if rec.id == nil {
+		return nil, fmt.Errorf("memdb: actor has no id")
+	}
+	if ib, ok := actor.(inboxer); ok && ib.GetActivityStreamsInbox() != nil {
+		if rec.inbox, err = toId(ib.GetActivityStreamsInbox()); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("memdb: actor %s has no inbox", rec.id)
+	}
+	if ob, ok := actor.(outboxer); ok && ob.GetActivityStreamsOutbox() != nil {
+		if rec.outbox, err = toId(ob.GetActivityStreamsOutbox()); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("memdb: actor %s has no outbox", rec.id)
+	}
+	if f, ok := actor.(followerser); ok && f.GetActivityStreamsFollowers() != nil {
+		if rec.followers, err = toId(f.GetActivityStreamsFollowers()); err != nil {
+			return nil, err
+		}
+	}
+	if f, ok := actor.(followinger); ok && f.GetActivityStreamsFollowing() != nil {
+		if rec.following, err = toId(f.GetActivityStreamsFollowing()); err != nil {
+			return nil, err
+		}
+	}
+	if l, ok := actor.(likeder); ok && l.GetActivityStreamsLiked() != nil {
+		if rec.liked, err = toId(l.GetActivityStreamsLiked()); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// copyMap deeply copies a JSON map so stored values are never aliased by the
+// values handed out to callers.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+// copyValue deeply copies a JSON value.
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyMap(t)
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, elem := range t {
+			out[i] = copyValue(elem)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// toFollow deserializes a Follow.
+func toFollow(c context.Context, m map[string]interface{}) (vocab.ActivityStreamsFollow, error) {
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	follow, ok := t.(vocab.ActivityStreamsFollow)
+	if !ok {
+		return nil, fmt.Errorf("memdb: pending follow is a %s", t.GetTypeName())
+	}
+	return follow, nil
+}
@@ -0,0 +1,227 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// NodeInfoPath is the well-known path of the NodeInfo discovery
+	// document.
+	NodeInfoPath = "/.well-known/nodeinfo"
+	// nodeInfo20Path is the path of the NodeInfo 2.0 document.
+	nodeInfo20Path = "/nodeinfo/2.0"
+	// nodeInfo21Path is the path of the NodeInfo 2.1 document.
+	nodeInfo21Path = "/nodeinfo/2.1"
+	// nodeInfoSchemaPrefix is the prefix of the NodeInfo schema IRIs.
+	nodeInfoSchemaPrefix = "http://nodeinfo.diaspora.software/ns/schema/"
+	// activityPubProtocol is the NodeInfo name of the ActivityPub protocol.
+	activityPubProtocol = "activitypub"
+)
+
+// NodeInfoSoftware describes the software running a server.
+type NodeInfoSoftware struct {
+	// Name is the canonical name of the software, which must consist of
+	// lowercase letters, digits, and hyphens.
+	Name string `json:"name"`
+	// Version is the version of the software.
+	Version string `json:"version"`
+	// Repository is the URL of the source code. Only in NodeInfo 2.1.
+	Repository string `json:"repository,omitempty"`
+	// Homepage is the URL of the software's homepage. Only in NodeInfo
+	// 2.1.
+	Homepage string `json:"homepage,omitempty"`
+}
+
+// NodeInfoStats are the usage statistics of a server.
+type NodeInfoStats struct {
+	// TotalUsers is the number of registered users.
+	TotalUsers int
+	// ActiveHalfyear is the number of users active in the past 180 days.
+	ActiveHalfyear int
+	// ActiveMonth is the number of users active in the past 30 days.
+	ActiveMonth int
+	// LocalPosts is the number of posts made by users of the server.
+	LocalPosts int
+	// LocalComments is the number of comments made by users of the
+	// server.
+	LocalComments int
+	// OpenRegistrations is true if new users may sign up.
+	OpenRegistrations bool
+	// Metadata is free form information about the server.
+	Metadata map[string]interface{}
+}
+
+// NodeInfoStatsProvider provides the statistics served in NodeInfo documents.
+type NodeInfoStatsProvider interface {
+	// NodeInfoStats returns the current statistics of the server.
+	NodeInfoStats(c context.Context) (NodeInfoStats, error)
+}
+
+// nodeInfoLink is a link in the NodeInfo discovery document.
+type nodeInfoLink struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+// nodeInfoDiscovery is the NodeInfo discovery document.
+type nodeInfoDiscovery struct {
+	Links []nodeInfoLink `json:"links"`
+}
+
+// nodeInfoUsers are the user counts of a NodeInfo document.
+type nodeInfoUsers struct {
+	Total          int `json:"total"`
+	ActiveHalfyear int `json:"activeHalfyear"`
+	ActiveMonth    int `json:"activeMonth"`
+}
+
+// nodeInfoUsage is the usage of a NodeInfo document.
+type nodeInfoUsage struct {
+	Users         nodeInfoUsers `json:"users"`
+	LocalPosts    int           `json:"localPosts"`
+	LocalComments int           `json:"localComments"`
+}
+
+// nodeInfoServices are the third party services of a NodeInfo document.
+type nodeInfoServices struct {
+	Inbound  []string `json:"inbound"`
+	Outbound []string `json:"outbound"`
+}
+
+// nodeInfo is a NodeInfo 2.0 or 2.1 document.
+type nodeInfo struct {
+	Version           string                 `json:"version"`
+	Software          NodeInfoSoftware       `json:"software"`
+	Protocols         []string               `json:"protocols"`
+	Services          nodeInfoServices       `json:"services"`
+	OpenRegistrations bool                   `json:"openRegistrations"`
+	Usage             nodeInfoUsage          `json:"usage"`
+	Metadata          map[string]interface{} `json:"metadata"`
+}
+
+// goFedSoftware returns the NodeInfoSoftware describing go-fed, based on its
+// user agent.
+func goFedSoftware() NodeInfoSoftware {
+	product := strings.Trim(goFedUserAgent(), "()")
+	s := NodeInfoSoftware{
+		Repository: "https://github.com/go-fed/activity",
+		Homepage:   "https://go-fed.org",
+	}
+	if i := strings.Index(product, " "); i >= 0 {
+		s.Version = product[i+1:]
+		product = product[:i]
+	}
+	s.Name = strings.SplitN(product, "/", 2)[0]
+	return s
+}
+
+// NewNodeInfoHandler creates a HandlerFunc serving the NodeInfo discovery
+// document at NodeInfoPath, as well as the NodeInfo 2.0 and 2.1 documents it
+// links to at "/nodeinfo/2.0" and "/nodeinfo/2.1" on the host.
+//
+// The software describes the application, and defaults to go-fed when its
+// Name is empty. The documents always list the "activitypub" protocol, and
+// their usage statistics are obtained from the stats provider on every
+// request.
+//
+// The returned HandlerFunc reports whether the request was a GET request to one
+// of these paths.
+func NewNodeInfoHandler(host *url.URL, software NodeInfoSoftware, stats NodeInfoStatsProvider) HandlerFunc {
+	if len(software.Name) == 0 {
+		software = goFedSoftware()
+	}
+	base := &url.URL{
+		Scheme: host.Scheme,
+		Host:   host.Host,
+	}
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isNodeInfoRequest bool, err error) {
+		if r.Method != "GET" {
+			return
+		}
+		var doc interface{}
+		contentType := "application/json"
+		switch r.URL.Path {
+		case NodeInfoPath:
+			d := nodeInfoDiscovery{}
+			for _, v := range []string{"2.0", "2.1"} {
+				href := *base
+				href.Path = "/nodeinfo/" + v
+				d.Links = append(d.Links, nodeInfoLink{
+					Rel:  nodeInfoSchemaPrefix + v,
+					Href: href.String(),
+				})
+			}
+			doc = d
+		case nodeInfo20Path, nodeInfo21Path:
+			v := strings.TrimPrefix(r.URL.Path, "/nodeinfo/")
+			var n nodeInfo
+			n, err = toNodeInfo(c, v, software, stats)
+			if err != nil {
+				return
+			}
+			doc = n
+			contentType = fmt.Sprintf("application/json; profile=\"%s%s#\"", nodeInfoSchemaPrefix, v)
+		default:
+			return
+		}
+		isNodeInfoRequest = true
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return
+		}
+		w.Header().Set(contentTypeHeader, contentType)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+		n, err := w.Write(raw)
+		if err != nil {
+			return
+		} else if n != len(raw) {
+			err = fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+			return
+		}
+		return
+	}
+}
+
+// toNodeInfo creates the NodeInfo document of the given schema version.
+func toNodeInfo(c context.Context, schema string, software NodeInfoSoftware, stats NodeInfoStatsProvider) (n nodeInfo, err error) {
+	s, err := stats.NodeInfoStats(c)
+	if err != nil {
+		return
+	}
+	if schema == "2.0" {
+		// The 2.0 schema does not allow these properties.
+		software.Repository = ""
+		software.Homepage = ""
+	}
+	metadata := s.Metadata
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	n = nodeInfo{
+		Version:   schema,
+		Software:  software,
+		Protocols: []string{activityPubProtocol},
+		Services: nodeInfoServices{
+			Inbound:  []string{},
+			Outbound: []string{},
+		},
+		OpenRegistrations: s.OpenRegistrations,
+		Usage: nodeInfoUsage{
+			Users: nodeInfoUsers{
+				Total:          s.TotalUsers,
+				ActiveHalfyear: s.ActiveHalfyear,
+				ActiveMonth:    s.ActiveMonth,
+			},
+			LocalPosts:    s.LocalPosts,
+			LocalComments: s.LocalComments,
+		},
+		Metadata: metadata,
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// staticNodeInfoStats is a NodeInfoStatsProvider with fixed statistics.
+type staticNodeInfoStats NodeInfoStats
+
+func (s staticNodeInfoStats) NodeInfoStats(c context.Context) (NodeInfoStats, error) {
+	return NodeInfoStats(s), nil
+}
+
+// TestNodeInfo tests serving the NodeInfo documents.
+func TestNodeInfo(t *testing.T) {
+	ctx := context.Background()
+	h := NewNodeInfoHandler(mustParse(testMyInboxIRI), NodeInfoSoftware{}, staticNodeInfoStats{
+		TotalUsers: 3,
+		LocalPosts: 7,
+	})
+	getFn := func(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		resp := httptest.NewRecorder()
+		handled, err := h(ctx, resp, httptest.NewRequest("GET", "https://example.com"+path, nil))
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		var m map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		return resp, m
+	}
+	t.Run("ServesDiscovery", func(t *testing.T) {
+		// Run
+		resp, m := getFn(NodeInfoPath)
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+		links := m["links"].([]interface{})
+		assertEqual(t, len(links), 2)
+		assertEqual(t, links[1].(map[string]interface{})["rel"], "http://nodeinfo.diaspora.software/ns/schema/2.1")
+		assertEqual(t, links[1].(map[string]interface{})["href"], "https://example.com/nodeinfo/2.1")
+	})
+	t.Run("Serves21Document", func(t *testing.T) {
+		// Run
+		resp, m := getFn("/nodeinfo/2.1")
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, m["version"], "2.1")
+		assertEqual(t, m["protocols"].([]interface{})[0], "activitypub")
+		software := m["software"].(map[string]interface{})
+		assertEqual(t, software["name"], "go-fed")
+		assertEqual(t, software["version"], version)
+		usage := m["usage"].(map[string]interface{})
+		assertEqual(t, usage["users"].(map[string]interface{})["total"], float64(3))
+		assertEqual(t, usage["localPosts"], float64(7))
+	})
+	t.Run("Serves20DocumentWithoutRepository", func(t *testing.T) {
+		// Run
+		_, m := getFn("/nodeinfo/2.0")
+		// Verify
+		assertEqual(t, m["version"], "2.0")
+		_, ok := m["software"].(map[string]interface{})["repository"]
+		assertEqual(t, ok, false)
+	})
+	t.Run("IgnoresOtherPaths", func(t *testing.T) {
+		// Run
+		handled, err := h(ctx, httptest.NewRecorder(), httptest.NewRequest("GET", testMyInboxIRI, nil))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+}
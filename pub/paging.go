@@ -0,0 +1,224 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// pageQuery is the query parameter requesting a page of a collection.
+	pageQuery = "page"
+	// maxIdQuery is the query parameter requesting the items strictly
+	// older than the given item id.
+	maxIdQuery = "max_id"
+	// minIdQuery is the query parameter requesting the items strictly
+	// newer than the given item id.
+	minIdQuery = "min_id"
+)
+
+// DefaultPageSize is the maximum number of items on a page of an inbox or
+// outbox requested by the library.
+const DefaultPageSize = 20
+
+// ErrNotPaged is returned by the methods of a PagingDelegateActor when the
+// application does not page the requested collection, so that GetInbox or
+// GetOutbox is used instead.
+var ErrNotPaged = errors.New("collection is not paged")
+
+// PageRequest is a request for the top-level OrderedCollection, or for one of
+// its pages, parsed from the query parameters of a GET request.
+//
+// Items in an inbox or outbox are ordered newest first.
+type PageRequest struct {
+	// Page is true when a page was requested, and false when the top-level
+	// OrderedCollection was requested.
+	Page bool
+	// MaxId, if not empty, requests the page of items older than the item
+	// with this id.
+	MaxId string
+	// MinId, if not empty, requests the page of items newer than the item
+	// with this id.
+	MinId string
+	// Limit is the maximum number of items on the page. A page with fewer
+	// items is the last page in its direction.
+	Limit int
+}
+
+// ParsePageRequest parses the 'page', 'max_id', and 'min_id' query parameters
+// of the request.
+//
+// Requesting either 'max_id' or 'min_id' implies 'page=true'. A requested page
+// is limited to DefaultPageSize items.
+func ParsePageRequest(r *http.Request) PageRequest {
+	q := r.URL.Query()
+	p := PageRequest{
+		MaxId: q.Get(maxIdQuery),
+		MinId: q.Get(minIdQuery),
+	}
+	p.Page = q.Get(pageQuery) == "true" || len(p.MaxId) > 0 || len(p.MinId) > 0
+	if p.Page {
+		p.Limit = DefaultPageSize
+	}
+	return p
+}
+
+// query returns the encoded query parameters requesting this page. The Limit
+// is not part of the query.
+func (p PageRequest) query() string {
+	q := url.Values{}
+	if p.Page {
+		q.Set(pageQuery, "true")
+	}
+	if len(p.MaxId) > 0 {
+		q.Set(maxIdQuery, p.MaxId)
+	}
+	if len(p.MinId) > 0 {
+		q.Set(minIdQuery, p.MinId)
+	}
+	return q.Encode()
+}
+
+// InboxPager is optionally implemented by a FederatingProtocol in order to
+// serve the inbox as a paginated OrderedCollection instead of the single page
+// returned by GetInbox.
+type InboxPager interface {
+	// GetInboxPage returns the requested page of the inbox of the actor
+	// for this request, and the total number of items in the inbox.
+	//
+	// When the top-level collection is requested, only totalItems is used
+	// and the returned page may be nil.
+	//
+	// The page must not have more than page.Limit items. A page with
+	// fewer items is treated as the end of the collection in the
+	// direction it was requested.
+	//
+	// The library sets the 'id' and 'partOf' of the page. If the page has
+	// items, it also sets the 'next' and 'prev' links that are not already
+	// set, omitting 'prev' on the first page and either link at the end of
+	// the collection.
+	//
+	// Returning ErrNotPaged serves the single page returned by GetInbox
+	// instead.
+	//
+	// AuthenticateGetInbox will be called prior to this.
+	GetInboxPage(c context.Context, r *http.Request, page PageRequest) (p vocab.ActivityStreamsOrderedCollectionPage, totalItems int, err error)
+}
+
+// OutboxPager is optionally implemented by a CommonBehavior in order to serve
+// the outbox as a paginated OrderedCollection instead of the single page
+// returned by GetOutbox.
+type OutboxPager interface {
+	// GetOutboxPage returns the requested page of the outbox of the actor
+	// for this request, and the total number of items in the outbox.
+	//
+	// When the top-level collection is requested, only totalItems is used
+	// and the returned page may be nil.
+	//
+	// The page must not have more than page.Limit items. A page with
+	// fewer items is treated as the end of the collection in the
+	// direction it was requested.
+	//
+	// The library sets the 'id' and 'partOf' of the page. If the page has
+	// items, it also sets the 'next' and 'prev' links that are not already
+	// set, omitting 'prev' on the first page and either link at the end of
+	// the collection.
+	//
+	// Returning ErrNotPaged serves the single page returned by GetOutbox
+	// instead.
+	//
+	// AuthenticateGetOutbox will be called prior to this.
+	GetOutboxPage(c context.Context, r *http.Request, page PageRequest) (p vocab.ActivityStreamsOrderedCollectionPage, totalItems int, err error)
+}
+
+// PagingDelegateActor is optionally implemented by a DelegateActor in order
+// to serve paginated inboxes and outboxes.
+//
+// Returning ErrNotPaged falls back to GetInbox or GetOutbox.
+type PagingDelegateActor interface {
+	InboxPager
+	OutboxPager
+}
+
+// collectionIRI returns the id of the collection being requested, without any
+// query parameters.
+func collectionIRI(r *http.Request) *url.URL {
+	u := *r.URL
+	u.Host = r.Host
+	u.Scheme = "https"
+	u.RawQuery = ""
+	u.Fragment = ""
+	return &u
+}
+
+// pageIRI returns the id of the page of the collection.
+func pageIRI(collection *url.URL, page PageRequest) *url.URL {
+	u := *collection
+	u.RawQuery = page.query()
+	return &u
+}
+
+// toTopLevelCollection creates the top-level OrderedCollection, whose 'first'
+// page is not embedded.
+func toTopLevelCollection(collection *url.URL, totalItems int) vocab.ActivityStreamsOrderedCollection {
+	oc := streams.NewActivityStreamsOrderedCollection()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(collection)
+	oc.SetJSONLDId(id)
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(totalItems)
+	oc.SetActivityStreamsTotalItems(total)
+	first := streams.NewActivityStreamsFirstProperty()
+	first.SetIRI(pageIRI(collection, PageRequest{Page: true}))
+	oc.SetActivityStreamsFirst(first)
+	return oc
+}
+
+// setPageLinks sets the 'id', 'partOf', 'next', and 'prev' properties of a
+// page of the collection.
+//
+// The 'next' and 'prev' links are based on the ids of the last and first
+// items on the page, and are only set if there are items and they are not
+// already set. A 'prev' link is not set on the first page, nor on a page
+// requested with a min_id that has fewer items than the limit. A 'next' link
+// is not set on any other page that has fewer items than the limit.
+func setPageLinks(p vocab.ActivityStreamsOrderedCollectionPage, collection *url.URL, page PageRequest) error {
+	id := streams.NewJSONLDIdProperty()
+	id.Set(pageIRI(collection, page))
+	p.SetJSONLDId(id)
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(collection)
+	p.SetActivityStreamsPartOf(partOf)
+	oi := p.GetActivityStreamsOrderedItems()
+	if oi == nil || oi.Len() == 0 {
+		return nil
+	}
+	// A short page reached the end of the collection in the direction it
+	// was requested: older items for max_id, newer items for min_id.
+	short := page.Limit > 0 && oi.Len() < page.Limit
+	isNewer := len(page.MinId) > 0
+	hasOlder := !short || isNewer
+	hasNewer := len(page.MaxId) > 0 || (isNewer && !short)
+	if p.GetActivityStreamsNext() == nil && hasOlder {
+		lastId, err := ToId(oi.At(oi.Len() - 1))
+		if err != nil {
+			return err
+		}
+		next := streams.NewActivityStreamsNextProperty()
+		next.SetIRI(pageIRI(collection, PageRequest{Page: true, MaxId: lastId.String()}))
+		p.SetActivityStreamsNext(next)
+	}
+	if p.GetActivityStreamsPrev() == nil && hasNewer {
+		firstId, err := ToId(oi.At(0))
+		if err != nil {
+			return err
+		}
+		prev := streams.NewActivityStreamsPrevProperty()
+		prev.SetIRI(pageIRI(collection, PageRequest{Page: true, MinId: firstId.String()}))
+		p.SetActivityStreamsPrev(prev)
+	}
+	return nil
+}
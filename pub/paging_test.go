@@ -0,0 +1,227 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pagingDelegateActor is a DelegateActor that pages its inbox.
+type pagingDelegateActor struct {
+	*MockDelegateActor
+	page       vocab.ActivityStreamsOrderedCollectionPage
+	totalItems int
+	requested  PageRequest
+}
+
+func (p *pagingDelegateActor) GetInboxPage(c context.Context, r *http.Request, page PageRequest) (vocab.ActivityStreamsOrderedCollectionPage, int, error) {
+	p.requested = page
+	return p.page, p.totalItems, nil
+}
+
+func (p *pagingDelegateActor) GetOutboxPage(c context.Context, r *http.Request, page PageRequest) (vocab.ActivityStreamsOrderedCollectionPage, int, error) {
+	return nil, 0, ErrNotPaged
+}
+
+// toGetRequest creates an ActivityPub GET request.
+func toGetRequest(iri string) *http.Request {
+	r := httptest.NewRequest("GET", iri, nil)
+	r.Header.Set("Accept", "application/activity+json")
+	return r
+}
+
+// TestParsePageRequest tests parsing the paging query parameters.
+func TestParsePageRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected PageRequest
+	}{
+		{
+			name:     "top-level collection",
+			query:    "",
+			expected: PageRequest{},
+		},
+		{
+			name:     "first page",
+			query:    "?page=true",
+			expected: PageRequest{Page: true, Limit: DefaultPageSize},
+		},
+		{
+			name:     "max_id implies page",
+			query:    "?max_id=https%3A%2F%2Fexample.com%2F1",
+			expected: PageRequest{Page: true, MaxId: "https://example.com/1", Limit: DefaultPageSize},
+		},
+		{
+			name:     "min_id",
+			query:    "?page=true&min_id=2",
+			expected: PageRequest{Page: true, MinId: "2", Limit: DefaultPageSize},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := ParsePageRequest(httptest.NewRequest("GET", testMyInboxIRI+test.query, nil))
+			assertEqual(t, p, test.expected)
+		})
+	}
+}
+
+// TestBaseActorPaging tests serving a paged inbox.
+func TestBaseActorPaging(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (d *pagingDelegateActor, c *MockClock, a Actor) {
+		setupData()
+		d = &pagingDelegateActor{MockDelegateActor: NewMockDelegateActor(ctl)}
+		c = NewMockClock(ctl)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		a = NewCustomActor(d, false, true, c)
+		return
+	}
+	t.Run("ServesTopLevelCollection", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		d.totalItems = 3
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyInboxIRI)
+		d.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := a.GetInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		expected := toTopLevelCollection(mustParse(testMyInboxIRI), 3)
+		assertByteEqual(t, resp.Body.Bytes(), mustSerializeToBytes(expected))
+		assertEqual(t, expected.GetActivityStreamsFirst().GetIRI().String(), testMyInboxIRI+"?page=true")
+	})
+	t.Run("SetsPageLinks", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		d.page = streams.NewActivityStreamsOrderedCollectionPage()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testFederatedActivityIRI))
+		for i := 2; i < DefaultPageSize; i++ {
+			oi.AppendIRI(mustParse(fmt.Sprintf("%s/%d", testFederatedActivityIRI, i)))
+		}
+		oi.AppendIRI(mustParse(testFederatedActivityIRI2))
+		d.page.SetActivityStreamsOrderedItems(oi)
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyInboxIRI + "?page=true&max_id=x")
+		d.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := a.GetInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, d.requested, PageRequest{Page: true, MaxId: "x", Limit: DefaultPageSize})
+		assertEqual(t, d.page.GetJSONLDId().Get().String(), testMyInboxIRI+"?max_id=x&page=true")
+		assertEqual(t, d.page.GetActivityStreamsPartOf().GetIRI().String(), testMyInboxIRI)
+		assertEqual(t, ParsePageRequest(httptest.NewRequest("GET", d.page.GetActivityStreamsNext().GetIRI().String(), nil)), PageRequest{Page: true, MaxId: testFederatedActivityIRI2, Limit: DefaultPageSize})
+		assertEqual(t, ParsePageRequest(httptest.NewRequest("GET", d.page.GetActivityStreamsPrev().GetIRI().String(), nil)), PageRequest{Page: true, MinId: testFederatedActivityIRI, Limit: DefaultPageSize})
+	})
+	t.Run("OmitsPrevOnFirstPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		d.page = streams.NewActivityStreamsOrderedCollectionPage()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		for i := 0; i < DefaultPageSize; i++ {
+			oi.AppendIRI(mustParse(fmt.Sprintf("%s/%d", testFederatedActivityIRI, i)))
+		}
+		d.page.SetActivityStreamsOrderedItems(oi)
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyInboxIRI + "?page=true")
+		d.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		_, err := a.GetInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertNotEqual(t, d.page.GetActivityStreamsNext(), nil)
+		assertEqual(t, d.page.GetActivityStreamsPrev(), nil)
+	})
+	t.Run("OmitsNextOnShortPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		d.page = streams.NewActivityStreamsOrderedCollectionPage()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testFederatedActivityIRI))
+		d.page.SetActivityStreamsOrderedItems(oi)
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyInboxIRI + "?page=true&max_id=x")
+		d.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		_, err := a.GetInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, d.page.GetActivityStreamsNext(), nil)
+		assertNotEqual(t, d.page.GetActivityStreamsPrev(), nil)
+	})
+	t.Run("OmitsPrevOnShortNewerPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		d.page = streams.NewActivityStreamsOrderedCollectionPage()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testFederatedActivityIRI))
+		d.page.SetActivityStreamsOrderedItems(oi)
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyInboxIRI + "?page=true&min_id=x")
+		d.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		_, err := a.GetInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertNotEqual(t, d.page.GetActivityStreamsNext(), nil)
+		assertEqual(t, d.page.GetActivityStreamsPrev(), nil)
+	})
+	t.Run("KeepsLinksSetByApplication", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		d.page = streams.NewActivityStreamsOrderedCollectionPage()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testFederatedActivityIRI))
+		d.page.SetActivityStreamsOrderedItems(oi)
+		next := streams.NewActivityStreamsNextProperty()
+		next.SetIRI(mustParse(testFederatedActivityIRI2))
+		d.page.SetActivityStreamsNext(next)
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyInboxIRI + "?page=true")
+		d.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		_, err := a.GetInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, d.page.GetActivityStreamsNext().GetIRI().String(), testFederatedActivityIRI2)
+	})
+	t.Run("FallsBackWhenNotPaged", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		d, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toGetRequest(testMyOutboxIRI)
+		d.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+		d.EXPECT().GetOutbox(ctx, req).Return(testOrderedCollectionWithFederatedId, nil)
+		// Run
+		handled, err := a.GetOutbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertByteEqual(t, resp.Body.Bytes(), mustSerializeToBytes(testOrderedCollectionWithFederatedId))
+	})
+}
@@ -82,11 +82,22 @@ type audiencer interface {
 	SetActivityStreamsAudience(i vocab.ActivityStreamsAudienceProperty)
 }
 
+// attachmenter is an ActivityStreams type with an 'attachment' property
+type attachmenter interface {
+	GetActivityStreamsAttachment() vocab.ActivityStreamsAttachmentProperty
+	SetActivityStreamsAttachment(i vocab.ActivityStreamsAttachmentProperty)
+}
+
 // inboxer is an ActivityStreams type with an 'inbox' property
 type inboxer interface {
 	GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
 }
 
+// followerser is an ActivityStreams type with a 'followers' property
+type followerser interface {
+	GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+}
+
 // attributedToer is an ActivityStreams type with an 'attributedTo' property
 type attributedToer interface {
 	GetActivityStreamsAttributedTo() vocab.ActivityStreamsAttributedToProperty
@@ -115,3 +126,15 @@ type actorer interface {
 type appendIRIer interface {
 	AppendIRI(v *url.URL)
 }
+
+// publicKeyer is an ActivityStreams type with a 'publicKey' property
+type publicKeyer interface {
+	GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+	SetW3IDSecurityV1PublicKey(i vocab.W3IDSecurityV1PublicKeyProperty)
+}
+
+// unknownPropertieser is an ActivityStreams type that retains properties not
+// in its vocabulary, such as the 'endpoints' of an actor
+type unknownPropertieser interface {
+	GetUnknownProperties() map[string]interface{}
+}
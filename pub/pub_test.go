@@ -453,16 +453,16 @@ func toAPRequest(r *http.Request) *http.Request {
 	if r.Method == "POST" {
 		existing, ok := r.Header[contentTypeHeader]
 		if ok {
-			r.Header[contentTypeHeader] = append(existing, activityStreamsMediaTypes[0])
+			r.Header[contentTypeHeader] = append(existing, activityJSONMediaType)
 		} else {
-			r.Header[contentTypeHeader] = []string{activityStreamsMediaTypes[0]}
+			r.Header[contentTypeHeader] = []string{activityJSONMediaType}
 		}
 	} else if r.Method == "GET" {
 		existing, ok := r.Header[acceptHeader]
 		if ok {
-			r.Header[acceptHeader] = append(existing, activityStreamsMediaTypes[0])
+			r.Header[acceptHeader] = append(existing, activityJSONMediaType)
 		} else {
-			r.Header[acceptHeader] = []string{activityStreamsMediaTypes[0]}
+			r.Header[acceptHeader] = []string{activityJSONMediaType}
 		}
 	} else {
 		panic("cannot toAPRequest with method " + r.Method)
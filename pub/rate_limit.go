@@ -0,0 +1,291 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// retryAfterHeader is the header peers use to indicate how long to
+	// wait before making another request.
+	retryAfterHeader = "Retry-After"
+	// defaultBatchDeliverWorkers caps the number of concurrent deliveries
+	// made by HttpSigTransport.BatchDeliver.
+	defaultBatchDeliverWorkers = 32
+)
+
+// RateLimits configures a RateLimitedClient. A zero value for any limit
+// disables that limit.
+type RateLimits struct {
+	// MaxConcurrent caps the number of requests in flight to all hosts.
+	MaxConcurrent int
+	// MaxConcurrentPerHost caps the number of requests in flight to any
+	// single host.
+	MaxConcurrentPerHost int
+	// PerHostRate is the sustained number of requests per second allowed
+	// to any single host.
+	PerHostRate float64
+	// PerHostBurst is the number of requests that may be made to a single
+	// host at once before PerHostRate applies. Defaults to 1 when
+	// PerHostRate is set.
+	PerHostBurst int
+	// DefaultRetryAfter is how long a host is backed off from after it
+	// responds with http.StatusTooManyRequests without a Retry-After
+	// header.
+	DefaultRetryAfter time.Duration
+	// MaxWait is the longest a request will wait for a host that asked to
+	// be backed off from. Requests that would wait longer fail
+	// immediately. Requests are otherwise bounded only by their context.
+	MaxWait time.Duration
+}
+
+// tokenBucket is a token bucket rate limiter for a single host.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// hostLimits tracks the limits for a single host.
+type hostLimits struct {
+	sem          chan struct{}
+	bucket       tokenBucket
+	blockedUntil time.Time
+}
+
+// HttpClient must be implemented by RateLimitedClient.
+var _ HttpClient = &RateLimitedClient{}
+
+// RateLimitedClient is an HttpClient that limits the rate and concurrency of
+// the requests made by another HttpClient, such as when used by an
+// HttpSigTransport for both Dereference and Deliver.
+//
+// Hosts responding with http.StatusTooManyRequests or
+// http.StatusServiceUnavailable and a Retry-After header are not sent further
+// requests until that time has passed. The response itself is returned as-is,
+// so the failure is still seen by the caller.
+type RateLimitedClient struct {
+	client HttpClient
+	clock  Clock
+	limits RateLimits
+	global chan struct{}
+	mu     sync.Mutex
+	hosts  map[string]*hostLimits
+}
+
+// NewRateLimitedClient wraps the client with the given limits.
+func NewRateLimitedClient(client HttpClient, clock Clock, limits RateLimits) *RateLimitedClient {
+	r := &RateLimitedClient{
+		client: client,
+		clock:  clock,
+		limits: limits,
+		hosts:  make(map[string]*hostLimits),
+	}
+	if limits.MaxConcurrent > 0 {
+		r.global = make(chan struct{}, limits.MaxConcurrent)
+	}
+	if limits.PerHostRate > 0 && r.limits.PerHostBurst <= 0 {
+		r.limits.PerHostBurst = 1
+	}
+	return r
+}
+
+// Do waits until the request is allowed by the limits, then sends it.
+//
+// The concurrency slots taken by the request are held until the response body
+// is closed.
+func (r *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	c := req.Context()
+	host := req.URL.Host
+	h := r.host(host)
+	if err := r.waitUnblocked(c, host, h); err != nil {
+		return nil, err
+	}
+	if err := r.waitForToken(c, h); err != nil {
+		return nil, err
+	}
+	if h.sem != nil {
+		if err := acquire(c, h.sem); err != nil {
+			return nil, err
+		}
+	}
+	if r.global != nil {
+		if err := acquire(c, r.global); err != nil {
+			release(h.sem)
+			return nil, err
+		}
+	}
+	done := func() {
+		release(r.global)
+		release(h.sem)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	r.backOff(h, resp)
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: done}
+	return resp, nil
+}
+
+// host returns the limits for the host, creating them if needed.
+func (r *RateLimitedClient) host(host string) *hostLimits {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hosts[host]
+	if !ok {
+		h = &hostLimits{
+			bucket: tokenBucket{
+				tokens: float64(r.limits.PerHostBurst),
+				last:   r.clock.Now(),
+			},
+		}
+		if r.limits.MaxConcurrentPerHost > 0 {
+			h.sem = make(chan struct{}, r.limits.MaxConcurrentPerHost)
+		}
+		r.hosts[host] = h
+	}
+	return h
+}
+
+// waitUnblocked waits until the host is no longer being backed off from.
+func (r *RateLimitedClient) waitUnblocked(c context.Context, host string, h *hostLimits) error {
+	r.mu.Lock()
+	wait := h.blockedUntil.Sub(r.clock.Now())
+	r.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	} else if r.limits.MaxWait > 0 && wait > r.limits.MaxWait {
+		return fmt.Errorf("host %s is rate limited for another %s", host, wait)
+	}
+	return sleep(c, wait)
+}
+
+// waitForToken waits until the host's token bucket allows another request.
+func (r *RateLimitedClient) waitForToken(c context.Context, h *hostLimits) error {
+	if r.limits.PerHostRate <= 0 {
+		return nil
+	}
+	for {
+		r.mu.Lock()
+		now := r.clock.Now()
+		b := &h.bucket
+		b.tokens += now.Sub(b.last).Seconds() * r.limits.PerHostRate
+		if max := float64(r.limits.PerHostBurst); b.tokens > max {
+			b.tokens = max
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			r.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / r.limits.PerHostRate * float64(time.Second))
+		r.mu.Unlock()
+		if err := sleep(c, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// backOff records when the host may next be sent a request, if the response
+// asks for it.
+func (r *RateLimitedClient) backOff(h *hostLimits, resp *http.Response) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	now := r.clock.Now()
+	until, ok := parseRetryAfter(resp.Header.Get(retryAfterHeader), now)
+	if !ok {
+		if resp.StatusCode != http.StatusTooManyRequests || r.limits.DefaultRetryAfter <= 0 {
+			return
+		}
+		until = now.Add(r.limits.DefaultRetryAfter)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if until.After(h.blockedUntil) {
+		h.blockedUntil = until
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date, per RFC 7231 §7.1.3.
+func parseRetryAfter(v string, now time.Time) (until time.Time, ok bool) {
+	if len(v) == 0 {
+		return
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return
+		}
+		return now.Add(time.Duration(secs) * time.Second), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	return
+}
+
+// releasingBody releases the concurrency slots of a request once its body is
+// closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the body and releases the slots.
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// acquire takes a slot in the semaphore, or returns the context's error.
+func acquire(c context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// release frees a slot in the semaphore, which may be nil.
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// sleep waits for the duration, or returns the context's error.
+func sleep(c context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// batchDeliverWorkers returns how many deliveries BatchDeliver makes at once
+// using the client.
+func batchDeliverWorkers(client HttpClient) int {
+	switch v := client.(type) {
+	case *RateLimitedClient:
+		if v.limits.MaxConcurrent > 0 {
+			return v.limits.MaxConcurrent
+		}
+	case *CachingClient:
+		return batchDeliverWorkers(v.client)
+	}
+	return defaultBatchDeliverWorkers
+}
@@ -0,0 +1,133 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingClient is an HttpClient that tracks the requests in flight.
+type countingClient struct {
+	mu          sync.Mutex
+	calls       int
+	inFlight    int
+	maxInFlight int
+	status      int
+	header      http.Header
+}
+
+func (cc *countingClient) Do(req *http.Request) (*http.Response, error) {
+	cc.mu.Lock()
+	cc.calls++
+	cc.inFlight++
+	if cc.inFlight > cc.maxInFlight {
+		cc.maxInFlight = cc.inFlight
+	}
+	cc.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	cc.mu.Lock()
+	cc.inFlight--
+	cc.mu.Unlock()
+	status := cc.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     cc.header,
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}, nil
+}
+
+// TestRateLimitedClient tests the limits applied to requests.
+func TestRateLimitedClient(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) *MockClock {
+		c := NewMockClock(ctl)
+		c.EXPECT().Now().DoAndReturn(time.Now).AnyTimes()
+		return c
+	}
+	doFn := func(r *RateLimitedClient) error {
+		req, _ := http.NewRequest("GET", testFederatedActorIRI, nil)
+		resp, err := r.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	t.Run("CapsConcurrencyPerHost", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cc := &countingClient{}
+		r := NewRateLimitedClient(cc, setupFn(ctl), RateLimits{MaxConcurrentPerHost: 2})
+		// Run
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				doFn(r)
+			}()
+		}
+		wg.Wait()
+		// Verify
+		assertEqual(t, cc.calls, 8)
+		if cc.maxInFlight > 2 {
+			t.Fatalf("expected at most 2 requests in flight, got %d", cc.maxInFlight)
+		}
+	})
+	t.Run("LimitsRatePerHost", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cc := &countingClient{}
+		r := NewRateLimitedClient(cc, setupFn(ctl), RateLimits{PerHostRate: 50})
+		start := time.Now()
+		// Run
+		for i := 0; i < 3; i++ {
+			if err := doFn(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Verify
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Fatalf("expected requests to be spread out, took %s", elapsed)
+		}
+	})
+	t.Run("RespectsRetryAfter", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cc := &countingClient{
+			status: http.StatusTooManyRequests,
+			header: http.Header{retryAfterHeader: []string{"120"}},
+		}
+		r := NewRateLimitedClient(cc, setupFn(ctl), RateLimits{MaxWait: time.Minute})
+		// Run
+		first := doFn(r)
+		second := doFn(r)
+		// Verify
+		assertEqual(t, first, nil)
+		assertNotEqual(t, second, nil)
+		assertEqual(t, cc.calls, 1)
+	})
+}
+
+// TestParseRetryAfter tests parsing both forms of the Retry-After header.
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	until, ok := parseRetryAfter("30", now)
+	assertEqual(t, ok, true)
+	assertEqual(t, until, now.Add(30*time.Second))
+	until, ok = parseRetryAfter("Tue, 01 Jan 2019 00:05:00 GMT", now)
+	assertEqual(t, ok, true)
+	assertEqual(t, until.Equal(now.Add(5*time.Minute)), true)
+	_, ok = parseRetryAfter("soon", now)
+	assertEqual(t, ok, false)
+}
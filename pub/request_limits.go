@@ -0,0 +1,123 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// RequestLimits bounds the size and complexity of the ActivityStreams data
+// POSTed to inboxes and outboxes. A zero value for any limit disables that
+// limit.
+type RequestLimits struct {
+	// MaxBodyBytes is the largest request body accepted. Larger requests
+	// are answered with http.StatusRequestEntityTooLarge before being
+	// authenticated.
+	MaxBodyBytes int64
+	// MaxDepth is the deepest nesting of JSON objects and arrays accepted.
+	MaxDepth int
+	// MaxArrayLength is the most elements accepted in any one JSON array.
+	MaxArrayLength int
+	// MaxProperties is the most JSON object properties accepted in the
+	// whole request body, counting those of nested objects.
+	MaxProperties int
+}
+
+// DefaultRequestLimits are limits suitable for most applications. They are
+// applied unless a RequestLimiter is implemented.
+var DefaultRequestLimits = RequestLimits{
+	MaxBodyBytes:   1 << 20,
+	MaxDepth:       32,
+	MaxArrayLength: 10000,
+	MaxProperties:  10000,
+}
+
+// RequestLimiter is optionally implemented by a CommonBehavior or a
+// DelegateActor in order to change the limits of the requests POSTed to
+// inboxes and outboxes from the DefaultRequestLimits. Returning the zero
+// RequestLimits disables all limits.
+//
+// Bodies exceeding the limits are answered with
+// http.StatusRequestEntityTooLarge, and JSON exceeding them is answered with
+// http.StatusBadRequest, before the ActivityStreams data is deserialized.
+type RequestLimiter interface {
+	// RequestLimits returns the limits to apply.
+	RequestLimits(c context.Context) RequestLimits
+}
+
+// readLimitedBody reads the request body, if it is no larger than the limit,
+// and replaces it so that it may be read again.
+//
+// If ok is false and the error is nil, then a response has already been
+// written.
+func readLimitedBody(w http.ResponseWriter, r *http.Request, l RequestLimits) (ok bool, err error) {
+	if l.MaxBodyBytes <= 0 || r.Body == nil {
+		return true, nil
+	}
+	if r.ContentLength > l.MaxBodyBytes {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return false, nil
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(r.Body, l.MaxBodyBytes+1))
+	if err != nil {
+		return false, err
+	}
+	r.Body.Close()
+	if int64(len(raw)) > l.MaxBodyBytes {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return false, nil
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	return true, nil
+}
+
+// jsonContainer tracks a JSON object or array while checking JSON limits.
+type jsonContainer struct {
+	array  bool
+	tokens int
+}
+
+// checkJSONLimits scans the JSON for violations of the limits without
+// deserializing it.
+//
+// Malformed JSON is not reported, and is left to be rejected when it is
+// deserialized.
+func checkJSONLimits(raw []byte, l RequestLimits) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	var stack []*jsonContainer
+	properties := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		d, isDelim := tok.(json.Delim)
+		if isDelim && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			top.tokens++
+			if top.array && l.MaxArrayLength > 0 && top.tokens > l.MaxArrayLength {
+				return fmt.Errorf("array exceeds %d elements", l.MaxArrayLength)
+			} else if !top.array && top.tokens%2 == 1 {
+				// Object tokens alternate between keys and values.
+				properties++
+				if l.MaxProperties > 0 && properties > l.MaxProperties {
+					return fmt.Errorf("exceeds %d properties", l.MaxProperties)
+				}
+			}
+		}
+		if isDelim {
+			stack = append(stack, &jsonContainer{array: d == '['})
+			if l.MaxDepth > 0 && len(stack) > l.MaxDepth {
+				return fmt.Errorf("exceeds nesting depth of %d", l.MaxDepth)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package pub
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// limitingDelegateActor is a DelegateActor that limits requests.
+type limitingDelegateActor struct {
+	*MockDelegateActor
+	limits RequestLimits
+}
+
+func (l *limitingDelegateActor) RequestLimits(c context.Context) RequestLimits {
+	return l.limits
+}
+
+// TestRequestLimits tests rejecting oversized and overly complex POSTs.
+func TestRequestLimits(t *testing.T) {
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, limits RequestLimits) (delegate *MockDelegateActor, a Actor) {
+		delegate = NewMockDelegateActor(ctl)
+		a = NewCustomActor(
+			&limitingDelegateActor{delegate, limits},
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		return
+	}
+	t.Run("PostInboxBodyTooLarge", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, a := setupFn(ctl, RequestLimits{MaxBodyBytes: 16})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("PostInboxBodyTooLargeWithoutContentLength", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, a := setupFn(ctl, RequestLimits{MaxBodyBytes: 16})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		req.ContentLength = -1
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("PostInboxTooDeep", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, a := setupFn(ctl, RequestLimits{MaxBodyBytes: 1 << 20, MaxDepth: 1})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("PostInboxDefaultLimitsWithoutLimiter", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		a := NewCustomActor(
+			NewMockDelegateActor(ctl),
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		req.ContentLength = DefaultRequestLimits.MaxBodyBytes + 1
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("PostInboxZeroLimitsDisableLimits", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, a := setupFn(ctl, RequestLimits{})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		req.ContentLength = DefaultRequestLimits.MaxBodyBytes + 1
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, false, nil)
+		// Run
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+	})
+	t.Run("PostOutboxBodyTooLarge", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, a := setupFn(ctl, RequestLimits{MaxBodyBytes: 16})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostOutboxRequest(testMyCreate))
+		// Run
+		handled, err := a.PostOutbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
+}
+
+// TestCheckJSONLimits tests finding the JSON exceeding the limits.
+func TestCheckJSONLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		limits   RequestLimits
+		exceeded bool
+	}{
+		{
+			"Within Limits",
+			`{"a": [1, 2, {"b": 3}], "c": {"d": "e"}}`,
+			RequestLimits{MaxDepth: 3, MaxArrayLength: 3, MaxProperties: 4},
+			false,
+		},
+		{
+			"Too Deep",
+			`{"a": [{"b": [1]}]}`,
+			RequestLimits{MaxDepth: 3},
+			true,
+		},
+		{
+			"Array Too Long",
+			`{"a": [1, 2, 3, 4]}`,
+			RequestLimits{MaxArrayLength: 3},
+			true,
+		},
+		{
+			"Too Many Nested Properties",
+			`{"a": {"b": 1, "c": 2}, "d": {"e": 3}}`,
+			RequestLimits{MaxProperties: 4},
+			true,
+		},
+		{
+			"Object Values Are Not Properties",
+			`{"a": "b", "c": {"d": "e"}}`,
+			RequestLimits{MaxProperties: 3},
+			false,
+		},
+		{
+			"No Limits",
+			`[[[[[[1, 2, 3]]]]]]`,
+			RequestLimits{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := checkJSONLimits([]byte(test.input), test.limits); (err != nil) != test.exceeded {
+				t.Fatalf("expected exceeded %v, got %v", test.exceeded, err)
+			}
+		})
+	}
+}
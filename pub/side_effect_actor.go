@@ -13,6 +13,24 @@ import (
 // sideEffectActor must satisfy the DelegateActor interface.
 var _ DelegateActor = &sideEffectActor{}
 
+// PagingDelegateActor must be implemented by sideEffectActor.
+var _ PagingDelegateActor = &sideEffectActor{}
+
+// FollowApprovalDelegateActor must be implemented by sideEffectActor.
+var _ FollowApprovalDelegateActor = &sideEffectActor{}
+
+// InboxQueuer must be implemented by sideEffectActor.
+var _ InboxQueuer = &sideEffectActor{}
+
+// InboxFilterer must be implemented by sideEffectActor.
+var _ InboxFilterer = &sideEffectActor{}
+
+// CachePolicer must be implemented by sideEffectActor.
+var _ CachePolicer = &sideEffectActor{}
+
+// RequestLimiter must be implemented by sideEffectActor.
+var _ RequestLimiter = &sideEffectActor{}
+
 // sideEffectActor is a DelegateActor that handles the ActivityPub
 // implementation side effects, but requires a more opinionated application to
 // be written.
@@ -68,6 +86,52 @@ func (a *sideEffectActor) GetInbox(c context.Context, r *http.Request) (vocab.Ac
 	return a.s2s.GetInbox(c, r)
 }
 
+// GetOutboxPage delegates to the CommonBehavior, if it is an OutboxPager.
+//
+// Otherwise, if the Database is an AppendCollectionDatabase, the page is read
+// from the Database.
+func (a *sideEffectActor) GetOutboxPage(c context.Context, r *http.Request, page PageRequest) (vocab.ActivityStreamsOrderedCollectionPage, int, error) {
+	if p, ok := a.common.(OutboxPager); ok {
+		return p.GetOutboxPage(c, r, page)
+	} else if adb, ok := a.db.(AppendCollectionDatabase); ok {
+		return a.collectionPage(c, collectionIRI(r), page, adb.OutboxItems)
+	}
+	return nil, 0, ErrNotPaged
+}
+
+// GetInboxPage delegates to the FederatingProtocol, if it is an InboxPager.
+//
+// Otherwise, if the Database is an AppendCollectionDatabase, the page is read
+// from the Database.
+func (a *sideEffectActor) GetInboxPage(c context.Context, r *http.Request, page PageRequest) (vocab.ActivityStreamsOrderedCollectionPage, int, error) {
+	if p, ok := a.s2s.(InboxPager); ok {
+		return p.GetInboxPage(c, r, page)
+	} else if adb, ok := a.db.(AppendCollectionDatabase); ok {
+		return a.collectionPage(c, collectionIRI(r), page, adb.InboxItems)
+	}
+	return nil, 0, ErrNotPaged
+}
+
+// collectionPage reads a page of the inbox or outbox from the Database.
+func (a *sideEffectActor) collectionPage(c context.Context, boxIRI *url.URL, page PageRequest, items func(context.Context, *url.URL, PageRequest) ([]*url.URL, int, error)) (p vocab.ActivityStreamsOrderedCollectionPage, totalItems int, err error) {
+	err = a.db.Lock(c, boxIRI)
+	if err != nil {
+		return
+	}
+	defer a.db.Unlock(c, boxIRI)
+	ids, totalItems, err := items(c, boxIRI, page)
+	if err != nil {
+		return
+	}
+	p = streams.NewActivityStreamsOrderedCollectionPage()
+	oi := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, id := range ids {
+		oi.AppendIRI(id)
+	}
+	p.SetActivityStreamsOrderedItems(oi)
+	return
+}
+
 // AuthorizePostInbox defers to the federating protocol whether the peer request
 // is authorized based on the actors' ids.
 func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseWriter, activity Activity) (authorized bool, err error) {
@@ -97,43 +161,362 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
+	// Apply the federation policy, if any.
+	if p := a.federationPolicy(c); p != nil {
+		var actions PolicyAction
+		if actions, err = p.activityActions(activity); err != nil {
+			return
+		} else if actions&PolicyReject != 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		p.apply(activity, actions)
+	}
 	authorized = true
 	return
 }
 
+// InboxFilters returns the FederatingProtocol's InboxFilters if it is an
+// InboxFilterer, or nil otherwise.
+func (a *sideEffectActor) InboxFilters(c context.Context) []InboxFilter {
+	if f, ok := a.s2s.(InboxFilterer); ok {
+		return f.InboxFilters(c)
+	}
+	return nil
+}
+
 // PostInbox handles the side effects of determining whether to block the peer's
 // request, adding the activity to the actor's inbox, and triggering side
 // effects based on the activity's type.
+//
+// If the Database is a TxDatabase, the side effects are applied in a single
+// transaction.
 func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activity Activity) error {
-	isNew, err := a.addToInboxIfNew(c, inboxIRI, activity)
+	return a.withTx(c, func(c context.Context) error {
+		isNew, err := a.addToInboxIfNew(c, inboxIRI, activity)
+		if err != nil {
+			return err
+		}
+		if isNew {
+			return a.inboxSideEffects(c, inboxIRI, activity)
+		}
+		return nil
+	})
+}
+
+// inboxSideEffects triggers the side effects of an activity received in an
+// inbox, based on the activity's type.
+func (a *sideEffectActor) inboxSideEffects(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	wrapped, other, err := a.s2s.Callbacks(c)
 	if err != nil {
 		return err
 	}
-	if isNew {
-		wrapped, other, err := a.s2s.Callbacks(c)
+	// Populate side channels.
+	wrapped.db = a.db
+	wrapped.inboxIRI = inboxIRI
+	wrapped.newTransport = a.newTransport
+	wrapped.deliver = a.Deliver
+	wrapped.addToOutbox = a.addToOutbox
+	wrapped.addNewIds = a.AddNewIds
+	res, err := streams.NewTypeResolver(wrapped.callbacks(other)...)
+	if err != nil {
+		return err
+	}
+	if err = res.Resolve(c, activity); err != nil && !streams.IsUnmatchedErr(err) {
+		return err
+	} else if streams.IsUnmatchedErr(err) {
+		err = a.s2s.DefaultCallback(c, activity)
 		if err != nil {
 			return err
 		}
-		// Populate side channels.
-		wrapped.db = a.db
-		wrapped.inboxIRI = inboxIRI
-		wrapped.newTransport = a.common.NewTransport
-		wrapped.deliver = a.Deliver
-		wrapped.addNewIds = a.AddNewIds
-		res, err := streams.NewTypeResolver(wrapped.callbacks(other)...)
+	}
+	return nil
+}
+
+// PostSharedInbox adds the activity to each of the inboxes, then triggers the
+// side effects on behalf of the inboxes that had not yet received it.
+//
+// The side effects of the first such inbox store the activity's data. For the
+// other inboxes, only the side effects applying to the actor owning the inbox
+// are triggered, such as for a Follow of that actor, or a Move of an actor it
+// follows.
+//
+// If the Database is a TxDatabase, the side effects are applied in a single
+// transaction.
+func (a *sideEffectActor) PostSharedInbox(c context.Context, inboxes []*url.URL, activity Activity) error {
+	return a.withTx(c, func(c context.Context) error {
+		var newInboxes []*url.URL
+		for _, inboxIRI := range inboxes {
+			isNew, err := a.addToInboxIfNew(c, inboxIRI, activity)
+			if err != nil {
+				return err
+			} else if isNew {
+				newInboxes = append(newInboxes, inboxIRI)
+			}
+		}
+		for i, inboxIRI := range newInboxes {
+			if i > 0 && !isPerActorActivity(activity) {
+				break
+			}
+			if err := a.inboxSideEffects(c, inboxIRI, activity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// isPerActorActivity determines whether the side effects of the activity apply
+// to the actor owning the inbox receiving it, rather than only to the data
+// shared by every actor on this server.
+func isPerActorActivity(activity Activity) bool {
+	return streams.IsOrExtendsActivityStreamsFollow(activity) ||
+		streams.IsOrExtendsActivityStreamsAccept(activity) ||
+		streams.IsOrExtendsActivityStreamsUndo(activity) ||
+		streams.IsOrExtendsActivityStreamsMove(activity)
+}
+
+// SharedInboxRecipients determines the inboxes of the actors on this server
+// that an activity received at the shared inbox is for.
+//
+// Actors directly addressed in 'to', 'bto', 'cc', 'bcc', or 'audience' are
+// recipients. If the Database implements LocalFollowersDatabase, local
+// followers of the activity's actors are also recipients when the actor's
+// followers collection is addressed.
+func (a *sideEffectActor) SharedInboxRecipients(c context.Context, activity Activity) (inboxes []*url.URL, err error) {
+	addressed, err := getAddressed(activity)
+	if err != nil {
+		return
+	}
+	addressed = filterURLs(addressed, IsPublic)
+	// Directly addressed actors on this server.
+	for _, iri := range addressed {
+		var inbox *url.URL
+		inbox, err = a.localInbox(c, iri)
+		if err != nil {
+			return
+		} else if inbox != nil {
+			inboxes = append(inboxes, inbox)
+		}
+	}
+	// Local followers of the sending actors.
+	lf, ok := a.db.(LocalFollowersDatabase)
+	if !ok {
+		return dedupeIRIs(inboxes, nil), nil
+	}
+	actor := activity.GetActivityStreamsActor()
+	if actor == nil {
+		return dedupeIRIs(inboxes, nil), nil
+	}
+	addressedMap := make(map[string]bool, len(addressed))
+	for _, iri := range addressed {
+		addressedMap[iri.String()] = true
+	}
+	for iter := actor.Begin(); iter != actor.End(); iter = iter.Next() {
+		var actorIRI *url.URL
+		actorIRI, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		err = a.db.Lock(c, actorIRI)
+		if err != nil {
+			return
+		}
+		// WARNING: Unlock not deferred
+		var followers []*url.URL
+		followers, err = lf.LocalFollowers(c, actorIRI)
+		a.db.Unlock(c, actorIRI)
+		// Unlock by this point -- still need to handle err
+		if err != nil {
+			return
+		} else if len(followers) == 0 {
+			continue
+		}
+		var followerInboxes []*url.URL
+		for _, follower := range followers {
+			var inbox *url.URL
+			inbox, err = a.localInbox(c, follower)
+			if err != nil {
+				return
+			} else if inbox != nil {
+				followerInboxes = append(followerInboxes, inbox)
+			}
+		}
+		if len(followerInboxes) == 0 {
+			continue
+		}
+		var followersIRI *url.URL
+		followersIRI, err = a.followersOf(c, iter.GetType(), actorIRI, followerInboxes[0])
+		if err != nil {
+			return
+		} else if followersIRI != nil && addressedMap[followersIRI.String()] {
+			inboxes = append(inboxes, followerInboxes...)
+		}
+	}
+	return dedupeIRIs(inboxes, nil), nil
+}
+
+// localInbox returns the inbox of the actor with the given id if it is owned
+// by this server, or nil if it is not a local actor.
+func (a *sideEffectActor) localInbox(c context.Context, iri *url.URL) (inbox *url.URL, err error) {
+	err = a.db.Lock(c, iri)
+	if err != nil {
+		return
+	}
+	defer a.db.Unlock(c, iri)
+	if owns, err := a.db.Owns(c, iri); err != nil {
+		return nil, err
+	} else if !owns {
+		return nil, nil
+	}
+	t, err := a.db.Get(c, iri)
+	if err != nil {
+		return
+	}
+	if _, ok := t.(inboxer); !ok {
+		// Owned, but not an actor. For example, a collection.
+		return nil, nil
+	}
+	return getInbox(t)
+}
+
+// followersOf determines the followers collection of a peer actor. The actor
+// is dereferenced on behalf of the local actor owning the boxIRI if it was not
+// embedded in the activity.
+func (a *sideEffectActor) followersOf(c context.Context, actor vocab.Type, actorIRI, boxIRI *url.URL) (*url.URL, error) {
+	if actor == nil {
+		tp, err := a.newTransport(c, boxIRI, goFedUserAgent())
+		if err != nil {
+			return nil, err
+		}
+		b, err := tp.Dereference(c, actorIRI)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err = json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		actor, err = streams.ToType(c, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f, ok := actor.(followerser)
+	if !ok || f.GetActivityStreamsFollowers() == nil {
+		return nil, nil
+	}
+	return ToId(f.GetActivityStreamsFollowers())
+}
+
+// PendingFollows returns the Follow requests awaiting approval by the actor
+// owning the inbox.
+func (a *sideEffectActor) PendingFollows(c context.Context, inboxIRI *url.URL) (follows []vocab.ActivityStreamsFollow, err error) {
+	pdb, err := a.pendingFollowsDatabase()
+	if err != nil {
+		return
+	}
+	actorIRI, err := a.actorForInbox(c, inboxIRI)
+	if err != nil {
+		return
+	}
+	err = a.db.Lock(c, actorIRI)
+	if err != nil {
+		return
+	}
+	defer a.db.Unlock(c, actorIRI)
+	return pdb.PendingFollows(c, actorIRI)
+}
+
+// AcceptFollow accepts the pending Follow request, in the same way as
+// OnFollowAutomaticallyAccept.
+//
+// If the Database is a TxDatabase, the side effects are applied in a single
+// transaction.
+func (a *sideEffectActor) AcceptFollow(c context.Context, inboxIRI, followIRI *url.URL) error {
+	return a.resolvePendingFollow(c, inboxIRI, followIRI, true)
+}
+
+// RejectFollow rejects the pending Follow request, in the same way as
+// OnFollowAutomaticallyReject.
+//
+// If the Database is a TxDatabase, the side effects are applied in a single
+// transaction.
+func (a *sideEffectActor) RejectFollow(c context.Context, inboxIRI, followIRI *url.URL) error {
+	return a.resolvePendingFollow(c, inboxIRI, followIRI, false)
+}
+
+// resolvePendingFollow accepts or rejects the pending Follow request using the
+// FederatingWrappedCallbacks, then removes it.
+//
+// The request is only removed once it has been responded to, so that it is
+// still pending if responding fails.
+func (a *sideEffectActor) resolvePendingFollow(c context.Context, inboxIRI, followIRI *url.URL, accept bool) error {
+	pdb, err := a.pendingFollowsDatabase()
+	if err != nil {
+		return err
+	}
+	return a.withTx(c, func(c context.Context) error {
+		actorIRI, err := a.actorForInbox(c, inboxIRI)
 		if err != nil {
 			return err
 		}
-		if err = res.Resolve(c, activity); err != nil && !streams.IsUnmatchedErr(err) {
+		if err := a.db.Lock(c, actorIRI); err != nil {
 			return err
-		} else if streams.IsUnmatchedErr(err) {
-			err = a.s2s.DefaultCallback(c, activity)
-			if err != nil {
-				return err
+		}
+		// WARNING: Unlock not deferred.
+		pending, err := pdb.PendingFollows(c, actorIRI)
+		if err != nil {
+			a.db.Unlock(c, actorIRI)
+			return err
+		}
+		a.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
+		var follow vocab.ActivityStreamsFollow
+		for _, f := range pending {
+			if id := f.GetJSONLDId(); id != nil && id.Get().String() == followIRI.String() {
+				follow = f
+				break
 			}
 		}
+		if follow == nil {
+			return fmt.Errorf("no pending follow %s for actor %s", followIRI, actorIRI)
+		}
+		wrapped := FederatingWrappedCallbacks{
+			db:        a.db,
+			inboxIRI:  inboxIRI,
+			deliver:   a.Deliver,
+			addNewIds: a.AddNewIds,
+		}
+		if err := wrapped.respondToFollow(c, actorIRI, follow, accept); err != nil {
+			return err
+		}
+		if err := a.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		defer a.db.Unlock(c, actorIRI)
+		_, err = pdb.RemovePendingFollow(c, actorIRI, followIRI)
+		return err
+	})
+}
+
+// pendingFollowsDatabase returns the Database as a PendingFollowsDatabase.
+func (a *sideEffectActor) pendingFollowsDatabase() (PendingFollowsDatabase, error) {
+	pdb, ok := a.db.(PendingFollowsDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database does not implement PendingFollowsDatabase")
 	}
-	return nil
+	return pdb, nil
+}
+
+// actorForInbox returns the actor owning the inbox.
+func (a *sideEffectActor) actorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	err = a.db.Lock(c, inboxIRI)
+	if err != nil {
+		return
+	}
+	defer a.db.Unlock(c, inboxIRI)
+	return a.db.ActorForInbox(c, inboxIRI)
 }
 
 // InboxForwarding implements the 3-part inbox forwarding algorithm specified in
@@ -321,7 +704,20 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 //
 // This implementation assumes all types are meant to be delivered except for
 // the ActivityStreams Block type.
+//
+// If the Database is a TxDatabase, the side effects are applied in a single
+// transaction.
 func (a *sideEffectActor) PostOutbox(c context.Context, activity Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (deliverable bool, err error) {
+	err = a.withTx(c, func(c context.Context) (err error) {
+		deliverable, err = a.postOutbox(c, activity, outboxIRI, rawJSON)
+		return
+	})
+	return
+}
+
+// postOutbox adds the activity to the actor's outbox and triggers the side
+// effects based on the activity's type.
+func (a *sideEffectActor) postOutbox(c context.Context, activity Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (deliverable bool, err error) {
 	// TODO: Determine this if c2s is nil
 	deliverable = true
 	if a.c2s != nil {
@@ -336,7 +732,7 @@ func (a *sideEffectActor) PostOutbox(c context.Context, activity Activity, outbo
 		wrapped.outboxIRI = outboxIRI
 		wrapped.rawActivity = rawJSON
 		wrapped.clock = a.clock
-		wrapped.newTransport = a.common.NewTransport
+		wrapped.newTransport = a.newTransport
 		undeliverable := false
 		wrapped.undeliverable = &undeliverable
 		var res *streams.TypeResolver
@@ -425,6 +821,10 @@ func (a *sideEffectActor) WrapInCreate(c context.Context, obj vocab.Type, outbox
 
 // deliverToRecipients will take a prepared Activity and send it to specific
 // recipients on behalf of an actor.
+//
+// The error from the Transport's BatchDeliver is returned unchanged, so that a
+// *BatchDeliverError reaches the application with the result of every
+// recipient.
 func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL, activity Activity, recipients []*url.URL) error {
 	m, err := streams.Serialize(activity)
 	if err != nil {
@@ -434,7 +834,77 @@ func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL
 	if err != nil {
 		return err
 	}
-	tp, err := a.common.NewTransport(c, boxIRI, goFedUserAgent())
+	if pending := pendingDeliveries(c); pending != nil {
+		*pending = append(*pending, pendingDelivery{
+			boxIRI:     boxIRI,
+			payload:    b,
+			recipients: recipients,
+		})
+		return nil
+	}
+	return a.deliverPayload(c, boxIRI, b, recipients)
+}
+
+// federationPolicy returns the CommonBehavior's FederationPolicy if it is a
+// FederationPolicer, or nil otherwise.
+func (a *sideEffectActor) federationPolicy(c context.Context) *FederationPolicy {
+	if fp, ok := a.common.(FederationPolicer); ok {
+		return fp.FederationPolicy(c)
+	}
+	return nil
+}
+
+// newTransport creates a Transport with the CommonBehavior, which refuses
+// requests to peers rejected by the FederationPolicy, if any.
+func (a *sideEffectActor) newTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+	t, err := a.common.NewTransport(c, actorBoxIRI, gofedAgent)
+	if err != nil {
+		return nil, err
+	}
+	if p := a.federationPolicy(c); p != nil {
+		t = &policyTransport{Transport: t, policy: p}
+	}
+	return t, nil
+}
+
+// CacheControl defers to the CommonBehavior if it is a CachePolicer, or else to
+// the Database if it is one. Otherwise, no Cache-Control header is set.
+func (a *sideEffectActor) CacheControl(c context.Context, t vocab.Type) string {
+	if cp, ok := a.common.(CachePolicer); ok {
+		return cp.CacheControl(c, t)
+	} else if cp, ok := a.db.(CachePolicer); ok {
+		return cp.CacheControl(c, t)
+	}
+	return ""
+}
+
+// RequestLimits returns the CommonBehavior's RequestLimits if it is a
+// RequestLimiter, or the DefaultRequestLimits otherwise.
+func (a *sideEffectActor) RequestLimits(c context.Context) RequestLimits {
+	if rl, ok := a.common.(RequestLimiter); ok {
+		return rl.RequestLimits(c)
+	}
+	return DefaultRequestLimits
+}
+
+// InboxQueue returns the CommonBehavior's InboxQueue if it is an InboxQueuer,
+// or nil otherwise.
+func (a *sideEffectActor) InboxQueue(c context.Context) *InboxQueue {
+	if iq, ok := a.common.(InboxQueuer); ok {
+		return iq.InboxQueue(c)
+	}
+	return nil
+}
+
+// deliverPayload sends the serialized activity to the recipients, or enqueues
+// it if the CommonBehavior is a DeliveryQueuer.
+func (a *sideEffectActor) deliverPayload(c context.Context, boxIRI *url.URL, b []byte, recipients []*url.URL) error {
+	if dq, ok := a.common.(DeliveryQueuer); ok {
+		if q := dq.DeliveryQueue(c); q != nil {
+			return q.Enqueue(c, boxIRI, b, recipients)
+		}
+	}
+	tp, err := a.newTransport(c, boxIRI, goFedUserAgent())
 	if err != nil {
 		return err
 	}
@@ -466,6 +936,9 @@ func (a *sideEffectActor) addToOutbox(c context.Context, outboxIRI *url.URL, act
 		return err
 	}
 	defer a.db.Unlock(c, outboxIRI)
+	if adb, ok := a.db.(AppendCollectionDatabase); ok {
+		return adb.AppendOutbox(c, outboxIRI, id.Get())
+	}
 	outbox, err := a.db.GetOutbox(c, outboxIRI)
 	if err != nil {
 		return err
@@ -506,6 +979,10 @@ func (a *sideEffectActor) addToInboxIfNew(c context.Context, inboxIRI *url.URL,
 	}
 	// It is a new id, acquire the inbox.
 	isNew = true
+	if adb, ok := a.db.(AppendCollectionDatabase); ok {
+		err = adb.AppendInbox(c, inboxIRI, id.Get())
+		return
+	}
 	inbox, err := a.db.GetInbox(c, inboxIRI)
 	if err != nil {
 		return
@@ -577,7 +1054,7 @@ func (a *sideEffectActor) hasInboxForwardingValues(c context.Context, inboxIRI *
 	// Recur Preparation: Try fetching the IRIs so we can recur into them.
 	for _, iri := range iris {
 		// Dereferencing the IRI.
-		tport, err := a.common.NewTransport(c, inboxIRI, goFedUserAgent())
+		tport, err := a.newTransport(c, inboxIRI, goFedUserAgent())
 		if err != nil {
 			return false, err
 		}
@@ -616,7 +1093,9 @@ func (a *sideEffectActor) hasInboxForwardingValues(c context.Context, inboxIRI *
 //
 // Only call if both the social and federated protocol are supported.
 func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activity Activity) (r []*url.URL, err error) {
-	// Get inboxes of recipients
+	// Get inboxes of recipients. The 'bto' and 'bcc' recipients are kept
+	// separate, as they must never share a delivery with other actors.
+	var hidden []*url.URL
 	if to := activity.GetActivityStreamsTo(); to != nil {
 		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
 			var val *url.URL
@@ -634,7 +1113,7 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 			if err != nil {
 				return
 			}
-			r = append(r, val)
+			hidden = append(hidden, val)
 		}
 	}
 	if cc := activity.GetActivityStreamsCc(); cc != nil {
@@ -654,7 +1133,7 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 			if err != nil {
 				return
 			}
-			r = append(r, val)
+			hidden = append(hidden, val)
 		}
 	}
 	if audience := activity.GetActivityStreamsAudience(); audience != nil {
@@ -675,19 +1154,40 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 	// 2. If an object is addressed to the Public special collection, a
 	//    server MAY deliver that object to all known sharedInbox endpoints
 	//    on the network.
+	//
+	// Both are done by delivering to the sharedInbox of actors that are
+	// either in an addressed collection or receiving a public activity.
+	public := containsPublic(r)
 	r = filterURLs(r, IsPublic)
-	t, err := a.common.NewTransport(c, outboxIRI, goFedUserAgent())
+	hidden = filterURLs(hidden, IsPublic)
+	// Never deliver to peers rejected by the federation policy.
+	policy := a.federationPolicy(c)
+	if policy != nil {
+		r = policy.filter(r)
+		hidden = policy.filter(hidden)
+	}
+	t, err := a.newTransport(c, outboxIRI, goFedUserAgent())
 	if err != nil {
 		return nil, err
 	}
-	receiverActors, err := a.resolveInboxes(c, t, r, 0, a.s2s.MaxDeliveryRecursionDepth(c))
+	maxDepth := a.s2s.MaxDeliveryRecursionDepth(c)
+	receiverActors, err := a.resolveInboxes(c, t, r, 0, maxDepth)
 	if err != nil {
 		return nil, err
 	}
-	targets, err := getInboxes(receiverActors)
+	targets, err := getDeliveryInboxes(receiverActors, r, public)
 	if err != nil {
 		return nil, err
 	}
+	hiddenActors, err := a.resolveInboxes(c, t, hidden, 0, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	hiddenTargets, err := getInboxes(hiddenActors)
+	if err != nil {
+		return nil, err
+	}
+	targets = append(targets, hiddenTargets...)
 	// Get inboxes of sender.
 	err = a.db.Lock(c, outboxIRI)
 	if err != nil {
@@ -719,6 +1219,9 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 		return nil, err
 	}
 	r = dedupeIRIs(targets, []*url.URL{ignore})
+	if policy != nil {
+		r = policy.filter(r)
+	}
 	stripHiddenRecipients(activity)
 	return r, nil
 }
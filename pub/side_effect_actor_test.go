@@ -2,6 +2,8 @@ package pub
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
 	"net/http/httptest"
@@ -1143,3 +1145,388 @@ func TestWrapInCreate(t *testing.T) {
 		t.Errorf("Not yet implemented.")
 	})
 }
+
+// localFollowersDatabase is a Database that can also look up local followers.
+type localFollowersDatabase struct {
+	*MockDatabase
+	followers map[string][]*url.URL
+}
+
+func (l *localFollowersDatabase) LocalFollowers(c context.Context, actorIRI *url.URL) ([]*url.URL, error) {
+	return l.followers[actorIRI.String()], nil
+}
+
+// TestSharedInbox tests receiving activities at a shared inbox.
+func TestSharedInbox(t *testing.T) {
+	ctx := context.Background()
+	const (
+		testMyActorIRI         = "https://example.com/addison"
+		testMyActorIRI2        = "https://example.com/sam"
+		testMyInboxIRI2        = "https://example.com/sam/inbox"
+		testMyOutboxIRI2       = "https://example.com/sam/outbox"
+		testNewActorIRI        = "https://new.example.com/dakota"
+		testFederatedFollowers = "https://other.example.com/dakota/followers"
+	)
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, fp *MockFederatingProtocol, db *MockDatabase, a *sideEffectActor) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		fp = NewMockFederatingProtocol(ctl)
+		db = NewMockDatabase(ctl)
+		a = &sideEffectActor{
+			common: c,
+			s2s:    fp,
+			db:     db,
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	// newLocalActor creates a local Person with an inbox.
+	newLocalActor := func() vocab.ActivityStreamsPerson {
+		p := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testMyActorIRI))
+		p.SetJSONLDId(id)
+		inbox := streams.NewActivityStreamsInboxProperty()
+		inbox.SetIRI(mustParse(testMyInboxIRI))
+		p.SetActivityStreamsInbox(inbox)
+		return p
+	}
+	// newListen creates a Listen from a peer addressed to the given IRI.
+	newListen := func(actor vocab.ActivityStreamsActorProperty, to string) vocab.ActivityStreamsListen {
+		l := streams.NewActivityStreamsListen()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		l.SetJSONLDId(id)
+		l.SetActivityStreamsActor(actor)
+		toProp := streams.NewActivityStreamsToProperty()
+		toProp.AppendIRI(mustParse(to))
+		toProp.AppendIRI(mustParse(PublicActivityPubIRI))
+		l.SetActivityStreamsTo(toProp)
+		return l
+	}
+	t.Run("ReturnsDirectlyAddressedLocalActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, db, a := setupFn(ctl)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		listen := newListen(actor, testMyActorIRI)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Owns(ctx, mustParse(testMyActorIRI)).Return(true, nil),
+			db.EXPECT().Get(ctx, mustParse(testMyActorIRI)).Return(newLocalActor(), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, listen)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+	})
+	t.Run("ReturnsLocalFollowersIfFollowersAddressed", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, db, a := setupFn(ctl)
+		a.db = &localFollowersDatabase{db, map[string][]*url.URL{
+			testFederatedActorIRI: {mustParse(testMyActorIRI)},
+		}}
+		peer := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI))
+		peer.SetJSONLDId(id)
+		followers := streams.NewActivityStreamsFollowersProperty()
+		followers.SetIRI(mustParse(testFederatedFollowers))
+		peer.SetActivityStreamsFollowers(followers)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendActivityStreamsPerson(peer)
+		listen := newListen(actor, testFederatedFollowers)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testFederatedFollowers)),
+			db.EXPECT().Owns(ctx, mustParse(testFederatedFollowers)).Return(false, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testFederatedFollowers)),
+			db.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI)),
+			db.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Owns(ctx, mustParse(testMyActorIRI)).Return(true, nil),
+			db.EXPECT().Get(ctx, mustParse(testMyActorIRI)).Return(newLocalActor(), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, listen)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+	})
+	// expectAddedToInboxes expects the activity to be new to each inbox.
+	expectAddedToInboxes := func(db *MockDatabase, inboxes ...*url.URL) {
+		for _, inboxIRI := range inboxes {
+			gomock.InOrder(
+				db.EXPECT().Lock(ctx, inboxIRI),
+				db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
+				db.EXPECT().GetInbox(ctx, inboxIRI).Return(streams.NewActivityStreamsOrderedCollectionPage(), nil),
+				db.EXPECT().SetInbox(ctx, gomock.Any()).Return(nil),
+				db.EXPECT().Unlock(ctx, inboxIRI),
+			)
+		}
+	}
+	t.Run("DoesSharedSideEffectsOnce", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, db, a := setupFn(ctl)
+		inboxIRI := mustParse(testMyInboxIRI)
+		inboxIRI2 := mustParse(testMyInboxIRI2)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, inboxIRI),
+			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(true, nil),
+			db.EXPECT().Unlock(ctx, inboxIRI),
+		)
+		expectAddedToInboxes(db, inboxIRI2)
+		fp.EXPECT().Callbacks(ctx).Return(FederatingWrappedCallbacks{}, nil, nil)
+		fp.EXPECT().DefaultCallback(ctx, testListen).Return(nil)
+		// Run
+		err := a.PostSharedInbox(ctx, []*url.URL{inboxIRI, inboxIRI2}, testListen)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("HandlesFollowAsTheFollowedActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, db, a := setupFn(ctl)
+		pdb := &pendingFollowsDatabase{MockDatabase: db}
+		a.db = pdb
+		inboxIRI := mustParse(testMyInboxIRI)
+		inboxIRI2 := mustParse(testMyInboxIRI2)
+		follow := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		follow.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		follow.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testMyActorIRI2))
+		follow.SetActivityStreamsObject(op)
+		expectAddedToInboxes(db, inboxIRI, inboxIRI2)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, inboxIRI),
+			db.EXPECT().ActorForInbox(ctx, inboxIRI).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, inboxIRI),
+			db.EXPECT().Lock(ctx, inboxIRI2),
+			db.EXPECT().ActorForInbox(ctx, inboxIRI2).Return(mustParse(testMyActorIRI2), nil),
+			db.EXPECT().Unlock(ctx, inboxIRI2),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI2)),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI2)),
+		)
+		fp.EXPECT().Callbacks(ctx).Return(FederatingWrappedCallbacks{OnFollow: OnFollowQueueForApproval}, nil, nil).Times(2)
+		// Run
+		err := a.PostSharedInbox(ctx, []*url.URL{inboxIRI, inboxIRI2}, follow)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(pdb.pending), 1)
+	})
+	t.Run("FollowsMoveTargetForEachLocalFollower", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, fp, db, a := setupFn(ctl)
+		tp := NewMockTransport(ctl)
+		inboxIRI := mustParse(testMyInboxIRI)
+		inboxIRI2 := mustParse(testMyInboxIRI2)
+		move := streams.NewActivityStreamsMove()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		move.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		move.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		move.SetActivityStreamsObject(op)
+		target := streams.NewActivityStreamsTargetProperty()
+		target.AppendIRI(mustParse(testNewActorIRI))
+		move.SetActivityStreamsTarget(target)
+		// newPeer creates a peer actor with an inbox, serialized with
+		// the additional properties.
+		newPeer := func(iri string, props map[string]interface{}) []byte {
+			p := streams.NewActivityStreamsPerson()
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(iri))
+			p.SetJSONLDId(id)
+			inbox := streams.NewActivityStreamsInboxProperty()
+			inbox.SetIRI(mustParse(iri + "/inbox"))
+			p.SetActivityStreamsInbox(inbox)
+			m := mustSerialize(p)
+			for k, v := range props {
+				m[k] = v
+			}
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}
+		// newFollowing creates a following collection with the moved
+		// actor.
+		newFollowing := func() vocab.ActivityStreamsCollection {
+			following := streams.NewActivityStreamsCollection()
+			items := streams.NewActivityStreamsItemsProperty()
+			items.AppendIRI(mustParse(testFederatedActorIRI))
+			following.SetActivityStreamsItems(items)
+			return following
+		}
+		// newSentFollow creates the stored Follow of the moved actor,
+		// and the outbox containing it.
+		newSentFollow := func(iri, actorIRI string) (vocab.ActivityStreamsFollow, vocab.ActivityStreamsOrderedCollectionPage) {
+			follow := toFollow(mustParse(actorIRI), mustParse(testFederatedActorIRI))
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(iri))
+			follow.SetJSONLDId(id)
+			outbox := streams.NewActivityStreamsOrderedCollectionPage()
+			oi := streams.NewActivityStreamsOrderedItemsProperty()
+			oi.AppendIRI(mustParse(iri))
+			outbox.SetActivityStreamsOrderedItems(oi)
+			return follow, outbox
+		}
+		following := newFollowing()
+		following2 := newFollowing()
+		sentFollow, outbox := newSentFollow(testNewActivityIRI2, testMyActorIRI)
+		sentFollow2, outbox2 := newSentFollow(testNewActivityIRI3, testMyActorIRI2)
+		expectAddedToInboxes(db, inboxIRI, inboxIRI2)
+		fp.EXPECT().Callbacks(ctx).Return(FederatingWrappedCallbacks{FollowMoveTarget: true}, nil, nil).Times(2)
+		fp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1).AnyTimes()
+		c.EXPECT().NewTransport(ctx, gomock.Any(), gomock.Any()).Return(tp, nil).AnyTimes()
+		tp.EXPECT().Dereference(ctx, mustParse(testNewActorIRI)).Return(newPeer(testNewActorIRI, map[string]interface{}{"alsoKnownAs": testFederatedActorIRI}), nil).AnyTimes()
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(newPeer(testFederatedActorIRI, nil), nil).AnyTimes()
+		tp.EXPECT().BatchDeliver(ctx, gomock.Any(), gomock.Any()).Return(nil).Times(4)
+		db.EXPECT().Lock(ctx, gomock.Any()).AnyTimes()
+		db.EXPECT().Unlock(ctx, gomock.Any()).AnyTimes()
+		db.EXPECT().NewId(ctx, gomock.Any()).Return(mustParse(testNewActivityIRI), nil).AnyTimes()
+		// The outbox is read to find the stored Follow, then once for
+		// each of the Follow and Undo that are stored.
+		db.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI)).Return(outbox, nil).Times(3)
+		db.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI2)).Return(outbox2, nil).Times(3)
+		db.EXPECT().Create(ctx, gomock.Any()).Return(nil).Times(4)
+		db.EXPECT().SetOutbox(ctx, gomock.Any()).Return(nil).Times(4)
+		db.EXPECT().Get(ctx, mustParse(testNewActivityIRI2)).Return(sentFollow, nil)
+		db.EXPECT().Get(ctx, mustParse(testNewActivityIRI3)).Return(sentFollow2, nil)
+		db.EXPECT().Get(ctx, gomock.Any()).Return(newLocalActor(), nil).AnyTimes()
+		db.EXPECT().ActorForInbox(ctx, inboxIRI).Return(mustParse(testMyActorIRI), nil)
+		db.EXPECT().ActorForInbox(ctx, inboxIRI2).Return(mustParse(testMyActorIRI2), nil)
+		db.EXPECT().OutboxForInbox(ctx, inboxIRI).Return(mustParse(testMyOutboxIRI), nil)
+		db.EXPECT().OutboxForInbox(ctx, inboxIRI2).Return(mustParse(testMyOutboxIRI2), nil)
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(mustParse(testMyActorIRI), nil).Times(2)
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI2)).Return(mustParse(testMyActorIRI2), nil).Times(2)
+		db.EXPECT().Following(ctx, mustParse(testMyActorIRI)).Return(following, nil)
+		db.EXPECT().Following(ctx, mustParse(testMyActorIRI2)).Return(following2, nil)
+		db.EXPECT().Update(ctx, following).Return(nil)
+		db.EXPECT().Update(ctx, following2).Return(nil)
+		// Run
+		err := a.PostSharedInbox(ctx, []*url.URL{inboxIRI, inboxIRI2}, move)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, following.GetActivityStreamsItems().Len(), 0)
+		assertEqual(t, following2.GetActivityStreamsItems().Len(), 0)
+	})
+}
+
+// appendCollectionDatabase is a Database with append-only inboxes and outboxes.
+type appendCollectionDatabase struct {
+	*MockDatabase
+	appended map[string][]*url.URL
+}
+
+func (a *appendCollectionDatabase) AppendInbox(c context.Context, inboxIRI, id *url.URL) error {
+	a.appended[inboxIRI.String()] = append([]*url.URL{id}, a.appended[inboxIRI.String()]...)
+	return nil
+}
+
+func (a *appendCollectionDatabase) AppendOutbox(c context.Context, outboxIRI, id *url.URL) error {
+	a.appended[outboxIRI.String()] = append([]*url.URL{id}, a.appended[outboxIRI.String()]...)
+	return nil
+}
+
+func (a *appendCollectionDatabase) InboxItems(c context.Context, inboxIRI *url.URL, page PageRequest) ([]*url.URL, int, error) {
+	return a.appended[inboxIRI.String()], len(a.appended[inboxIRI.String()]), nil
+}
+
+func (a *appendCollectionDatabase) OutboxItems(c context.Context, outboxIRI *url.URL, page PageRequest) ([]*url.URL, int, error) {
+	return a.appended[outboxIRI.String()], len(a.appended[outboxIRI.String()]), nil
+}
+
+// TestAppendCollectionDatabase tests the sideEffectActor using a Database
+// with append-only inboxes and outboxes.
+func TestAppendCollectionDatabase(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, adb *appendCollectionDatabase, a *sideEffectActor) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		adb = &appendCollectionDatabase{db, make(map[string][]*url.URL)}
+		a = &sideEffectActor{
+			common: NewMockCommonBehavior(ctl),
+			s2s:    NewMockFederatingProtocol(ctl),
+			db:     adb,
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	t.Run("AppendsNewInboxItems", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, adb, a := setupFn(ctl)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)),
+			db.EXPECT().InboxContains(ctx, mustParse(testMyInboxIRI), mustParse(testFederatedActivityIRI)).Return(false, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)),
+		)
+		// Run
+		isNew, err := a.addToInboxIfNew(ctx, mustParse(testMyInboxIRI), testListen)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, isNew, true)
+		assertEqual(t, len(adb.appended[testMyInboxIRI]), 1)
+		assertEqual(t, adb.appended[testMyInboxIRI][0].String(), testFederatedActivityIRI)
+	})
+	t.Run("AppendsOutboxItems", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, adb, a := setupFn(ctl)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI)),
+			db.EXPECT().Create(ctx, testListen),
+			db.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+		)
+		// Run
+		err := a.addToOutbox(ctx, mustParse(testMyOutboxIRI), testListen)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(adb.appended[testMyOutboxIRI]), 1)
+	})
+	t.Run("ServesPagesFromDatabase", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, adb, a := setupFn(ctl)
+		adb.appended[testMyOutboxIRI] = []*url.URL{mustParse(testFederatedActivityIRI)}
+		req := httptest.NewRequest("GET", testMyOutboxIRI+"?page=true", nil)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+		)
+		// Run
+		p, totalItems, err := a.GetOutboxPage(ctx, req, PageRequest{Page: true})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, totalItems, 1)
+		assertEqual(t, p.GetActivityStreamsOrderedItems().At(0).GetIRI().String(), testFederatedActivityIRI)
+	})
+}
@@ -69,8 +69,14 @@ type SocialWrappedCallbacks struct {
 	// It enforces that the actors on the Undo must correspond to all of the
 	// 'object' actors in some manner.
 	//
+	// The wrapping function then reverses the default side effects of
+	// undone Follow and Like activities: the objects of the Follow are
+	// removed from the 'following' collection, and the objects of the Like
+	// from the 'liked' collection.
+	//
 	// It is expected that the application will implement the proper
-	// reversal of activities that are being undone.
+	// reversal of any other side effects of activities that are being
+	// undone.
 	Undo func(context.Context, vocab.ActivityStreamsUndo) error
 	// Block handles additional side effects for the Block ActivityStreams
 	// type.
@@ -83,6 +89,14 @@ type SocialWrappedCallbacks struct {
 	// Note that go-fed does not federate 'Block' activities received in the
 	// Social Protocol.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Move handles additional side effects for the Move ActivityStreams
+	// type.
+	//
+	// The wrapping callback ensures the 'Move' has a 'target' and that its
+	// only 'object' is the actor owning this outbox, and addresses it to
+	// the followers of this actor so that all of them are notified, such as
+	// when migrating accounts.
+	Move func(context.Context, vocab.ActivityStreamsMove) error
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -122,6 +136,7 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableLike := true
 	enableUndo := true
 	enableBlock := true
+	enableMove := true
 	for _, fn := range fns {
 		switch fn.(type) {
 		default:
@@ -144,6 +159,8 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableUndo = false
 		case func(context.Context, vocab.ActivityStreamsBlock) error:
 			enableBlock = false
+		case func(context.Context, vocab.ActivityStreamsMove) error:
+			enableMove = false
 		}
 	}
 	if enableCreate {
@@ -173,6 +190,9 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableBlock {
 		fns = append(fns, w.block)
 	}
+	if enableMove {
+		fns = append(fns, w.move)
+	}
 	return fns
 }
 
@@ -505,15 +525,72 @@ func (w SocialWrappedCallbacks) undo(c context.Context, a vocab.ActivityStreamsU
 		return ErrObjectRequired
 	}
 	actors := a.GetActivityStreamsActor()
-	if err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.outboxIRI); err != nil {
+	objects, err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.outboxIRI)
+	if err != nil {
 		return err
 	}
+	// Reverse the side effects applied when the activities were posted, or
+	// when a Follow was accepted.
+	for _, t := range objects {
+		switch v := t.(type) {
+		case vocab.ActivityStreamsFollow:
+			err = w.removeObjectsFromActorCollection(c, v.GetActivityStreamsObject(), w.db.Following)
+		case vocab.ActivityStreamsLike:
+			err = w.removeObjectsFromActorCollection(c, v.GetActivityStreamsObject(), w.db.Liked)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	if w.Undo != nil {
 		return w.Undo(c, a)
 	}
 	return nil
 }
 
+// removeObjectsFromActorCollection removes the objects of an undone activity
+// from a collection of the actor owning this outbox, such as its 'liked' or
+// 'following' collection.
+func (w SocialWrappedCallbacks) removeObjectsFromActorCollection(c context.Context, op vocab.ActivityStreamsObjectProperty, collection func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error)) error {
+	if op == nil || op.Len() == 0 {
+		return nil
+	}
+	ids := make(map[string]bool, op.Len())
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		ids[id.String()] = true
+	}
+	// Get this actor's IRI.
+	if err := w.db.Lock(c, w.outboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForOutbox(c, w.outboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.outboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.outboxIRI)
+	// Unlock must be called by now and every branch above.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, actorIRI)
+	col, err := collection(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if removed, err := removeFromCollection(col, ids); err != nil {
+		return err
+	} else if !removed {
+		return nil
+	}
+	return w.db.Update(c, col)
+}
+
 // block implements the social Block activity side effects.
 func (w SocialWrappedCallbacks) block(c context.Context, a vocab.ActivityStreamsBlock) error {
 	*w.undeliverable = true
@@ -526,3 +603,79 @@ func (w SocialWrappedCallbacks) block(c context.Context, a vocab.ActivityStreams
 	}
 	return nil
 }
+
+// move implements the social Move activity side effects.
+func (w SocialWrappedCallbacks) move(c context.Context, a vocab.ActivityStreamsMove) error {
+	*w.undeliverable = false
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	target := a.GetActivityStreamsTarget()
+	if target == nil || target.Len() == 0 {
+		return ErrTargetRequired
+	}
+	// Get this actor's IRI.
+	if err := w.db.Lock(c, w.outboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForOutbox(c, w.outboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.outboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.outboxIRI)
+	// Unlock must be called by now and every branch above.
+	//
+	// Only the actor owning this outbox can be moved by it.
+	if op.Len() != 1 {
+		return fmt.Errorf("move must have exactly one object")
+	}
+	objectIRI, err := ToId(op.At(0))
+	if err != nil {
+		return err
+	} else if objectIRI.String() != actorIRI.String() {
+		return fmt.Errorf("move object %s is not the outbox actor %s", objectIRI, actorIRI)
+	}
+	// Now obtain this actor's 'followers' collection.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	followers, err := w.db.Followers(c, actorIRI)
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	w.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	followersIRI, err := GetId(followers)
+	if err != nil {
+		return err
+	}
+	// Address the followers, unless they already are.
+	addressed, err := getAddressed(a)
+	if err != nil {
+		return err
+	}
+	isAddressed := false
+	for _, iri := range addressed {
+		if iri.String() == followersIRI.String() {
+			isAddressed = true
+			break
+		}
+	}
+	if !isAddressed {
+		cc := a.GetActivityStreamsCc()
+		if cc == nil {
+			cc = streams.NewActivityStreamsCcProperty()
+			a.SetActivityStreamsCc(cc)
+		}
+		cc.AppendIRI(followersIRI)
+	}
+	if w.Move != nil {
+		return w.Move(c, a)
+	}
+	return nil
+}
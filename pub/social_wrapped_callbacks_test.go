@@ -0,0 +1,145 @@
+package pub
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+// TestSocialUndoReversesSideEffects tests that undoing a Like or Follow
+// removes its objects from the actor's collections.
+func TestSocialUndoReversesSideEffects(t *testing.T) {
+	const testMyActorIRI = "https://example.com/addison"
+	ctx := context.Background()
+	t.Run("RemovesObjectFromLiked", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		undeliverable := true
+		w := SocialWrappedCallbacks{
+			db:            db,
+			outboxIRI:     mustParse(testMyOutboxIRI),
+			undeliverable: &undeliverable,
+		}
+		like := streams.NewActivityStreamsLike()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testMyActorIRI))
+		like.SetActivityStreamsActor(actor)
+		likeOp := streams.NewActivityStreamsObjectProperty()
+		likeOp.AppendIRI(mustParse(testNoteId1))
+		like.SetActivityStreamsObject(likeOp)
+		undo := streams.NewActivityStreamsUndo()
+		undoActor := streams.NewActivityStreamsActorProperty()
+		undoActor.AppendIRI(mustParse(testMyActorIRI))
+		undo.SetActivityStreamsActor(undoActor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsLike(like)
+		undo.SetActivityStreamsObject(op)
+		liked := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testNoteId2))
+		items.AppendIRI(mustParse(testNoteId1))
+		liked.SetActivityStreamsItems(items)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Liked(ctx, mustParse(testMyActorIRI)).Return(liked, nil),
+			db.EXPECT().Update(ctx, liked),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		err := w.undo(ctx, undo)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, undeliverable, false)
+		assertEqual(t, items.Len(), 1)
+		assertEqual(t, items.At(0).GetIRI().String(), testNoteId2)
+	})
+}
+
+// TestSocialMove tests that a Move is addressed to the actor's followers.
+func TestSocialMove(t *testing.T) {
+	const (
+		testMyActorIRI     = "https://example.com/addison"
+		testMyFollowersIRI = "https://example.com/addison/followers"
+	)
+	ctx := context.Background()
+	t.Run("AddressesFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		undeliverable := true
+		w := SocialWrappedCallbacks{
+			db:            db,
+			outboxIRI:     mustParse(testMyOutboxIRI),
+			undeliverable: &undeliverable,
+		}
+		move := streams.NewActivityStreamsMove()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testMyActorIRI))
+		move.SetActivityStreamsObject(op)
+		target := streams.NewActivityStreamsTargetProperty()
+		target.AppendIRI(mustParse(testFederatedActorIRI))
+		move.SetActivityStreamsTarget(target)
+		followers := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testMyFollowersIRI))
+		followers.SetJSONLDId(id)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().Lock(ctx, mustParse(testMyActorIRI)),
+			db.EXPECT().Followers(ctx, mustParse(testMyActorIRI)).Return(followers, nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyActorIRI)),
+		)
+		// Run
+		err := w.move(ctx, move)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, undeliverable, false)
+		assertEqual(t, move.GetActivityStreamsCc().Len(), 1)
+		assertEqual(t, move.GetActivityStreamsCc().At(0).GetIRI().String(), testMyFollowersIRI)
+	})
+	t.Run("ErrorsIfObjectIsNotOutboxActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		undeliverable := true
+		w := SocialWrappedCallbacks{
+			db:            db,
+			outboxIRI:     mustParse(testMyOutboxIRI),
+			undeliverable: &undeliverable,
+		}
+		called := false
+		w.Move = func(c context.Context, m vocab.ActivityStreamsMove) error {
+			called = true
+			return nil
+		}
+		move := streams.NewActivityStreamsMove()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI2))
+		move.SetActivityStreamsObject(op)
+		target := streams.NewActivityStreamsTargetProperty()
+		target.AppendIRI(mustParse(testFederatedActorIRI))
+		move.SetActivityStreamsTarget(target)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)),
+			db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(mustParse(testMyActorIRI), nil),
+			db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)),
+		)
+		// Run
+		err := w.move(ctx, move)
+		// Verify
+		assertNotEqual(t, err, nil)
+		assertEqual(t, called, false)
+		assertEqual(t, move.GetActivityStreamsCc(), nil)
+	})
+}
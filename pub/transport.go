@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -34,8 +35,9 @@ func isSuccess(code int) bool {
 // requests if needed, and facilitating the traffic between this server and
 // another.
 //
-// The transport is exclusively used to issue requests on behalf of an actor,
-// and is never sending requests on behalf of the server in general.
+// The transport is exclusively used to issue requests on behalf of an actor.
+// Requests on behalf of the server in general are issued on behalf of an
+// InstanceActor.
 //
 // It may be reused multiple times, but never concurrently.
 type Transport interface {
@@ -45,6 +47,9 @@ type Transport interface {
 	// Deliver sends an ActivityStreams object.
 	Deliver(c context.Context, b []byte, to *url.URL) error
 	// BatchDeliver sends an ActivityStreams object to multiple recipients.
+	//
+	// Implementations are encouraged to return a *BatchDeliverError so
+	// that applications can tell which recipients failed, and how.
 	BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error
 }
 
@@ -54,7 +59,8 @@ var _ Transport = &HttpSigTransport{}
 // HttpSigTransport makes a dereference call using HTTP signatures to
 // authenticate the request on behalf of a particular actor.
 //
-// No rate limiting is applied.
+// No rate limiting is applied unless its HttpClient is a RateLimitedClient, and
+// no caching is done unless it is a CachingClient.
 //
 // Only one request is tried per call.
 type HttpSigTransport struct {
@@ -137,12 +143,19 @@ func (h HttpSigTransport) Dereference(c context.Context, iri *url.URL) ([]byte,
 
 // Deliver sends a POST request with an HTTP Signature.
 func (h HttpSigTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	_, err := h.deliver(c, b, to)
+	return err
+}
+
+// deliver sends a POST request with an HTTP Signature, returning the status
+// code of the response, if any.
+func (h HttpSigTransport) deliver(c context.Context, b []byte, to *url.URL) (int, error) {
 	byteCopy := make([]byte, len(b))
 	copy(byteCopy, b)
 	buf := bytes.NewBuffer(byteCopy)
 	req, err := http.NewRequest("POST", to.String(), buf)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	req = req.WithContext(c)
 	req.Header.Add(contentTypeHeader, contentTypeHeaderValue)
@@ -153,50 +166,188 @@ func (h HttpSigTransport) Deliver(c context.Context, b []byte, to *url.URL) erro
 	err = h.postSigner.SignRequest(h.privKey, h.pubKeyId, req, b)
 	h.postSignerMu.Unlock()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 	if !isSuccess(resp.StatusCode) {
-		return fmt.Errorf("POST request to %s failed (%d): %s", to.String(), resp.StatusCode, resp.Status)
+		return resp.StatusCode, &DeliverError{
+			Recipient:  to,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
 	}
-	return nil
+	return resp.StatusCode, nil
 }
 
-// BatchDeliver sends concurrent POST requests. Returns an error if any of the
-// requests had an error.
+// BatchDeliver sends concurrent POST requests. Returns a *BatchDeliverError if
+// any of the requests had an error.
+//
+// The number of concurrent requests is capped by the MaxConcurrent limit of a
+// RateLimitedClient, or a default otherwise.
 func (h HttpSigTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
 	var wg sync.WaitGroup
-	errCh := make(chan error, len(recipients))
-	for _, recipient := range recipients {
+	results := make([]DeliveryResult, len(recipients))
+	sem := make(chan struct{}, batchDeliverWorkers(h.client))
+	for i, recipient := range recipients {
 		wg.Add(1)
-		go func(r *url.URL) {
+		sem <- struct{}{}
+		go func(i int, r *url.URL) {
 			defer wg.Done()
-			if err := h.Deliver(c, b, r); err != nil {
-				errCh <- err
-			}
-		}(recipient)
+			defer func() { <-sem }()
+			start := h.clock.Now()
+			code, err := h.deliver(c, b, r)
+			results[i] = newDeliveryResult(r, code, err, h.clock.Now().Sub(start))
+		}(i, recipient)
 	}
 	wg.Wait()
-	errs := make([]string, 0, len(recipients))
-outer:
-	for {
-		select {
-		case e := <-errCh:
-			errs = append(errs, e.Error())
-		default:
-			break outer
+	for _, r := range results {
+		if r.Err != nil {
+			return &BatchDeliverError{Results: results}
 		}
 	}
-	if len(errs) > 0 {
-		return fmt.Errorf("batch deliver had at least one failure: %s", strings.Join(errs, "; "))
-	}
 	return nil
 }
 
+// FailureKind classifies the outcome of delivering to a recipient.
+type FailureKind int
+
+const (
+	// NoFailure means the delivery succeeded.
+	NoFailure FailureKind = iota
+	// TransientFailure means the delivery failed, but may succeed if
+	// retried later. Server errors, timeouts, and network errors are
+	// transient.
+	TransientFailure
+	// PermanentFailure means the delivery will not succeed if retried,
+	// such as when the inbox responds with http.StatusNotFound or
+	// http.StatusGone.
+	PermanentFailure
+)
+
+// String returns a human readable name for the FailureKind.
+func (f FailureKind) String() string {
+	switch f {
+	case NoFailure:
+		return "none"
+	case TransientFailure:
+		return "transient"
+	case PermanentFailure:
+		return "permanent"
+	default:
+		return fmt.Sprintf("FailureKind(%d)", int(f))
+	}
+}
+
+// classifyStatus determines whether an unsuccessful HTTP status code is a
+// permanent failure.
+//
+// Client errors are permanent, except for those that may succeed later such as
+// authentication failures caused by clock skew or rate limiting.
+func classifyStatus(code int) FailureKind {
+	if code < 400 || code >= 500 {
+		return TransientFailure
+	}
+	switch code {
+	case http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests:
+		return TransientFailure
+	default:
+		return PermanentFailure
+	}
+}
+
+// DeliverError is returned by HttpSigTransport.Deliver when the recipient
+// responds with an unsuccessful status code.
+type DeliverError struct {
+	// Recipient is the inbox the delivery was made to.
+	Recipient *url.URL
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Status is the HTTP status of the response.
+	Status string
+}
+
+// Error returns a description of the failed delivery.
+func (e *DeliverError) Error() string {
+	return fmt.Sprintf("POST request to %s failed (%d): %s", e.Recipient.String(), e.StatusCode, e.Status)
+}
+
+// Kind classifies the failure.
+func (e *DeliverError) Kind() FailureKind {
+	return classifyStatus(e.StatusCode)
+}
+
+// DeliveryResult is the outcome of delivering an activity to one recipient.
+type DeliveryResult struct {
+	// Recipient is the inbox the delivery was made to.
+	Recipient *url.URL
+	// StatusCode is the HTTP status code of the response, or zero if no
+	// response was received.
+	StatusCode int
+	// Kind classifies the outcome.
+	Kind FailureKind
+	// Duration is how long the attempt took.
+	Duration time.Duration
+	// Err is the error of a failed delivery, and nil on success.
+	Err error
+}
+
+// newDeliveryResult creates the DeliveryResult for an attempt that returned
+// the status code and error.
+func newDeliveryResult(recipient *url.URL, statusCode int, err error, d time.Duration) DeliveryResult {
+	r := DeliveryResult{
+		Recipient:  recipient,
+		StatusCode: statusCode,
+		Duration:   d,
+		Err:        err,
+	}
+	if err == nil {
+		return r
+	} else if de, ok := err.(*DeliverError); ok {
+		r.Kind = de.Kind()
+	} else {
+		r.Kind = TransientFailure
+	}
+	return r
+}
+
+// BatchDeliverError is returned by HttpSigTransport.BatchDeliver when at least
+// one delivery failed. It contains the result for every recipient, so that
+// applications may prune recipients that failed permanently and retry those
+// that failed transiently.
+type BatchDeliverError struct {
+	// Results has one entry per recipient, in the order given.
+	Results []DeliveryResult
+}
+
+// Error joins the errors of the failed deliveries.
+func (e *BatchDeliverError) Error() string {
+	errs := make([]string, 0, len(e.Results))
+	for _, r := range e.Results {
+		if r.Err != nil {
+			errs = append(errs, r.Err.Error())
+		}
+	}
+	return fmt.Sprintf("batch deliver had at least one failure: %s", strings.Join(errs, "; "))
+}
+
+// Failed returns the recipients whose delivery had the given kind of failure.
+func (e *BatchDeliverError) Failed(kind FailureKind) []*url.URL {
+	var iris []*url.URL
+	for _, r := range e.Results {
+		if r.Err != nil && r.Kind == kind {
+			iris = append(iris, r.Recipient)
+		}
+	}
+	return iris
+}
+
 // HttpClient sends http requests, and is an abstraction only needed by the
 // HttpSigTransport. The standard library's Client satisfies this interface.
 type HttpClient interface {
@@ -0,0 +1,99 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-fed/httpsig"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// statusClient is an HttpClient responding with a fixed status code per URL.
+type statusClient map[string]int
+
+func (s statusClient) Do(req *http.Request) (*http.Response, error) {
+	code := s[req.URL.String()]
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}, nil
+}
+
+// TestBatchDeliverResults tests the per-recipient results of BatchDeliver.
+func TestBatchDeliverResults(t *testing.T) {
+	ctx := context.Background()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSigner := func() httpsig.Signer {
+		s, _, err := httpsig.NewSigner(
+			[]httpsig.Algorithm{httpsig.RSA_SHA256},
+			httpsig.DigestSha256,
+			[]string{requestTargetHeader, "date", "digest"},
+			httpsig.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	t.Run("ClassifiesEachRecipient", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cl := NewMockClock(ctl)
+		cl.EXPECT().Now().Return(now()).AnyTimes()
+		client := statusClient{
+			testFederatedActorIRI:  http.StatusOK,
+			testFederatedActorIRI2: http.StatusGone,
+			testFederatedActorIRI3: http.StatusBadGateway,
+		}
+		tp := NewHttpSigTransport(client, "test", cl, newSigner(), newSigner(), testPublicKeyIRI, priv)
+		// Run
+		err := tp.BatchDeliver(ctx, []byte("{}"), []*url.URL{
+			mustParse(testFederatedActorIRI),
+			mustParse(testFederatedActorIRI2),
+			mustParse(testFederatedActorIRI3),
+		})
+		// Verify
+		be, ok := err.(*BatchDeliverError)
+		assertEqual(t, ok, true)
+		assertEqual(t, len(be.Results), 3)
+		assertEqual(t, be.Results[0].Kind, NoFailure)
+		assertEqual(t, be.Results[0].StatusCode, http.StatusOK)
+		assertEqual(t, be.Results[1].Kind, PermanentFailure)
+		assertEqual(t, be.Results[1].StatusCode, http.StatusGone)
+		assertEqual(t, be.Results[2].Kind, TransientFailure)
+		assertEqual(t, be.Results[2].StatusCode, http.StatusBadGateway)
+		assertEqual(t, len(be.Failed(PermanentFailure)), 1)
+		assertEqual(t, be.Failed(PermanentFailure)[0].String(), testFederatedActorIRI2)
+	})
+	t.Run("ReturnsNilOnSuccess", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cl := NewMockClock(ctl)
+		cl.EXPECT().Now().Return(now()).AnyTimes()
+		client := statusClient{testFederatedActorIRI: http.StatusAccepted}
+		tp := NewHttpSigTransport(client, "test", cl, newSigner(), newSigner(), testPublicKeyIRI, priv)
+		// Run
+		err := tp.BatchDeliver(ctx, []byte("{}"), []*url.URL{mustParse(testFederatedActorIRI)})
+		// Verify
+		assertEqual(t, err, nil)
+	})
+}
+
+// TestClassifyStatus tests which status codes are permanent failures.
+func TestClassifyStatus(t *testing.T) {
+	assertEqual(t, classifyStatus(http.StatusNotFound), PermanentFailure)
+	assertEqual(t, classifyStatus(http.StatusGone), PermanentFailure)
+	assertEqual(t, classifyStatus(http.StatusUnauthorized), TransientFailure)
+	assertEqual(t, classifyStatus(http.StatusTooManyRequests), TransientFailure)
+	assertEqual(t, classifyStatus(http.StatusInternalServerError), TransientFailure)
+}
@@ -0,0 +1,60 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// pendingDeliveriesKey is the context key for the deliveries made during a
+// transaction, which are held back until it commits.
+type pendingDeliveriesKey struct{}
+
+// pendingDelivery is a serialized activity to be delivered once the
+// transaction it was made in commits.
+type pendingDelivery struct {
+	boxIRI     *url.URL
+	payload    []byte
+	recipients []*url.URL
+}
+
+// pendingDeliveries returns the deliveries held back by the transaction in the
+// context, or nil if the context has no transaction.
+func pendingDeliveries(c context.Context) *[]pendingDelivery {
+	p, _ := c.Value(pendingDeliveriesKey{}).(*[]pendingDelivery)
+	return p
+}
+
+// withTx calls fn within a transaction if the Database is a TxDatabase, and
+// otherwise simply calls fn.
+//
+// The transaction is rolled back if fn returns an error. Deliveries made by
+// fn are only made once the transaction commits. If the context already
+// carries a transaction, fn joins it.
+func (a *sideEffectActor) withTx(c context.Context, fn func(c context.Context) error) error {
+	tdb, ok := a.db.(TxDatabase)
+	if !ok || pendingDeliveries(c) != nil {
+		return fn(c)
+	}
+	tx, err := tdb.Begin(c)
+	if err != nil {
+		return err
+	}
+	pending := &[]pendingDelivery{}
+	tx = context.WithValue(tx, pendingDeliveriesKey{}, pending)
+	if err = fn(tx); err != nil {
+		if rbErr := tdb.Rollback(tx); rbErr != nil {
+			return fmt.Errorf("%s; rollback failed: %s", err, rbErr)
+		}
+		return err
+	}
+	if err = tdb.Commit(tx); err != nil {
+		return err
+	}
+	for _, d := range *pending {
+		if err = a.deliverPayload(c, d.boxIRI, d.payload, d.recipients); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package pub
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// txDatabase is a Database that records the outcome of its transactions.
+type txDatabase struct {
+	*MockDatabase
+	began      int
+	committed  int
+	rolledBack int
+}
+
+func (t *txDatabase) Begin(c context.Context) (context.Context, error) {
+	t.began++
+	return c, nil
+}
+
+func (t *txDatabase) Commit(c context.Context) error {
+	t.committed++
+	return nil
+}
+
+func (t *txDatabase) Rollback(c context.Context) error {
+	t.rolledBack++
+	return nil
+}
+
+// TestWithTx tests grouping side effects in a transaction.
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	setupFn := func(ctl *gomock.Controller) (db *txDatabase, s *MemoryDeliveryStore, a *sideEffectActor) {
+		setupData()
+		db = &txDatabase{MockDatabase: NewMockDatabase(ctl)}
+		s = NewMemoryDeliveryStore()
+		cl := NewMockClock(ctl)
+		cl.EXPECT().Now().Return(now).AnyTimes()
+		q := NewDeliveryQueue(s, cl, nil, DefaultRetryPolicy, 1)
+		a = &sideEffectActor{
+			common: &queuingCommonBehavior{NewMockCommonBehavior(ctl), q},
+			db:     db,
+			clock:  cl,
+		}
+		return
+	}
+	t.Run("DeliversAfterCommit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, s, a := setupFn(ctl)
+		var pendingBeforeCommit int
+		// Run
+		err := a.withTx(ctx, func(c context.Context) error {
+			err := a.deliverToRecipients(c, mustParse(testMyOutboxIRI), testCreate, []*url.URL{
+				mustParse(testFederatedActorIRI),
+			})
+			pendingBeforeCommit = s.Len()
+			return err
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, db.began, 1)
+		assertEqual(t, db.committed, 1)
+		assertEqual(t, db.rolledBack, 0)
+		assertEqual(t, pendingBeforeCommit, 0)
+		assertEqual(t, s.Len(), 1)
+	})
+	t.Run("RollsBackWithoutDelivering", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, s, a := setupFn(ctl)
+		// Run
+		err := a.withTx(ctx, func(c context.Context) error {
+			a.deliverToRecipients(c, mustParse(testMyOutboxIRI), testCreate, []*url.URL{
+				mustParse(testFederatedActorIRI),
+			})
+			return testErr
+		})
+		// Verify
+		assertEqual(t, err, testErr)
+		assertEqual(t, db.committed, 0)
+		assertEqual(t, db.rolledBack, 1)
+		assertEqual(t, s.Len(), 0)
+	})
+	t.Run("JoinsExistingTransaction", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, a := setupFn(ctl)
+		// Run
+		err := a.withTx(ctx, func(c context.Context) error {
+			return a.withTx(c, func(c context.Context) error {
+				return nil
+			})
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, db.began, 1)
+		assertEqual(t, db.committed, 1)
+	})
+}
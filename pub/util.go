@@ -12,6 +12,7 @@ import (
 	"github.com/go-fed/activity/streams/vocab"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,42 +28,199 @@ var (
 	ErrTargetRequired = errors.New("target property required on the provided activity")
 )
 
-// activityStreamsMediaTypes contains all of the accepted ActivityStreams media
-// types. Generated at init time.
-var activityStreamsMediaTypes []string
+const (
+	// activityJSONMediaType is the ActivityStreams media type.
+	activityJSONMediaType = "application/activity+json"
+	// ldJSONMediaType is the JSON-LD media type, which is an ActivityStreams
+	// media type when it has the ActivityStreams profile.
+	ldJSONMediaType = "application/ld+json"
+	// activityStreamsProfile is the profile of the JSON-LD media type for
+	// ActivityStreams.
+	activityStreamsProfile = "https://www.w3.org/ns/activitystreams"
+	// htmlMediaType is the media type of web pages.
+	htmlMediaType = "text/html"
+	// qualityParam is the parameter of a media range in an Accept header
+	// giving its relative quality.
+	qualityParam = "q"
+)
 
-func init() {
-	activityStreamsMediaTypes = []string{
-		"application/activity+json",
-	}
-	jsonLdType := "application/ld+json"
-	for _, semi := range []string{";", " ;", " ; ", "; "} {
-		for _, profile := range []string{
-			"profile=https://www.w3.org/ns/activitystreams",
-			"profile=\"https://www.w3.org/ns/activitystreams\"",
-		} {
-			activityStreamsMediaTypes = append(
-				activityStreamsMediaTypes,
-				fmt.Sprintf("%s%s%s", jsonLdType, semi, profile))
+// mediaRange is a media type, or a media range from an Accept header, parsed
+// per RFC 7231 §3.1.1.1 and §5.3.2.
+type mediaRange struct {
+	// mediaType is the lowercase type and subtype, which may be wildcards.
+	mediaType string
+	// params are the parameters other than the quality, with lowercase
+	// names.
+	params map[string]string
+	// q is the quality, between 0 and 1.
+	q float64
+}
+
+// parseMediaRanges parses a comma separated list of media ranges, such as an
+// Accept header. Media ranges that cannot be parsed are skipped.
+func parseMediaRanges(header string) (ranges []mediaRange) {
+	for _, s := range splitHeaderList(header, ',') {
+		if r, ok := parseMediaRange(s); ok {
+			ranges = append(ranges, r)
 		}
 	}
+	return
 }
 
-// headerIsActivityPubMediaType returns true if the header string contains one
-// of the accepted ActivityStreams media types.
+// parseMediaRange parses a single media type or media range.
 //
-// Note we don't try to build a comprehensive parser and instead accept a
-// tolerable amount of whitespace since the HTTP specification is ambiguous
-// about the format and significance of whitespace.
-func headerIsActivityPubMediaType(header string) bool {
-	for _, mediaType := range activityStreamsMediaTypes {
-		if strings.Contains(header, mediaType) {
-			return true
+// Parameter values are tolerated without quotes even when they are not
+// tokens, such as the ActivityStreams profile IRI, since peers commonly send
+// them that way.
+func parseMediaRange(s string) (r mediaRange, ok bool) {
+	parts := splitHeaderList(s, ';')
+	if len(parts) == 0 {
+		return
+	}
+	r.mediaType = strings.ToLower(parts[0])
+	if i := strings.Index(r.mediaType, "/"); i <= 0 || i == len(r.mediaType)-1 {
+		return
+	}
+	r.params = make(map[string]string, len(parts)-1)
+	r.q = 1
+	for _, param := range parts[1:] {
+		i := strings.Index(param, "=")
+		if i <= 0 {
+			return
+		}
+		name := strings.ToLower(strings.TrimSpace(param[:i]))
+		value := unquote(strings.TrimSpace(param[i+1:]))
+		if name != qualityParam {
+			r.params[name] = value
+			continue
+		}
+		q, err := strconv.ParseFloat(value, 64)
+		if err != nil || q < 0 || q > 1 {
+			return
+		}
+		r.q = q
+	}
+	ok = true
+	return
+}
+
+// unquote removes the quotes and escapes of a quoted string, returning any
+// other string as-is.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for i := 1; i < len(s)-1; i++ {
+		if !escaped && s[i] == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitHeaderList splits a header on the separators that are not within
+// quoted strings, trimming whitespace and dropping empty elements.
+func splitHeaderList(header string, sep byte) (elems []string) {
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(header); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && header[i] == '\\':
+			escaped = true
+		case header[i] == '"':
+			quoted = !quoted
+		case !quoted && header[i] == sep:
+			if e := strings.TrimSpace(header[start:i]); len(e) > 0 {
+				elems = append(elems, e)
+			}
+			start = i + 1
+		}
+	}
+	if e := strings.TrimSpace(header[start:]); len(e) > 0 {
+		elems = append(elems, e)
+	}
+	return
+}
+
+// isActivityStreams returns true if the media range is exactly an
+// ActivityStreams media type, without wildcards.
+func (m mediaRange) isActivityStreams() bool {
+	switch m.mediaType {
+	case activityJSONMediaType:
+		return true
+	case ldJSONMediaType:
+		// The profile is a space separated list of IRIs.
+		for _, profile := range strings.Fields(m.params["profile"]) {
+			if profile == activityStreamsProfile {
+				return true
+			}
 		}
 	}
 	return false
 }
 
+// specificity returns how specifically the media range matches the media
+// type, from 1 for "*/*" to 3 for an exact match, or 0 if it does not.
+func (m mediaRange) specificity(mediaType string) int {
+	if m.mediaType == mediaType {
+		return 3
+	} else if m.mediaType == "*/*" {
+		return 1
+	}
+	i := strings.Index(mediaType, "/")
+	if i >= 0 && m.mediaType == mediaType[:i]+"/*" {
+		return 2
+	}
+	return 0
+}
+
+// activityStreamsQuality returns the highest quality of the ActivityStreams
+// media types in the media ranges. Wildcards do not count, as clients must
+// explicitly ask for ActivityStreams.
+func activityStreamsQuality(ranges []mediaRange) (q float64) {
+	for _, r := range ranges {
+		if r.isActivityStreams() && r.q > q {
+			q = r.q
+		}
+	}
+	return
+}
+
+// quality returns the quality of the media type given by its most specific
+// matching media range, or 0 if none match.
+func quality(ranges []mediaRange, mediaType string) (q float64) {
+	best := 0
+	for _, r := range ranges {
+		if s := r.specificity(mediaType); s > best {
+			best = s
+			q = r.q
+		}
+	}
+	return
+}
+
+// headerIsActivityPubMediaType returns true if the header lists one of the
+// ActivityStreams media types with a non-zero quality.
+func headerIsActivityPubMediaType(header string) bool {
+	return activityStreamsQuality(parseMediaRanges(header)) > 0
+}
+
+// acceptsActivityStreams returns true if the Accept header ranks an
+// ActivityStreams media type at least as high as HTML, so that web pages are
+// served to clients preferring them.
+func acceptsActivityStreams(accept string) bool {
+	ranges := parseMediaRanges(accept)
+	q := activityStreamsQuality(ranges)
+	return q > 0 && q >= quality(ranges, htmlMediaType)
+}
+
 const (
 	// The Content-Type header.
 	contentTypeHeader = "Content-Type"
@@ -76,10 +234,10 @@ func isActivityPubPost(r *http.Request) bool {
 	return r.Method == "POST" && headerIsActivityPubMediaType(r.Header.Get(contentTypeHeader))
 }
 
-// isActivityPubGet returns true if the request is a GET request that has the
-// ActivityStreams content type header
+// isActivityPubGet returns true if the request is a GET request whose Accept
+// header ranks ActivityStreams at least as high as HTML
 func isActivityPubGet(r *http.Request) bool {
-	return r.Method == "GET" && headerIsActivityPubMediaType(r.Header.Get(acceptHeader))
+	return r.Method == "GET" && acceptsActivityStreams(r.Header.Get(acceptHeader))
 }
 
 // dedupeOrderedItems deduplicates the 'orderedItems' within an ordered
@@ -360,6 +518,16 @@ func IsPublic(s string) bool {
 	return s == PublicActivityPubIRI || s == publicJsonLD || s == publicJsonLDAS
 }
 
+// containsPublic returns true if any of the IRIs is the Public collection.
+func containsPublic(u []*url.URL) bool {
+	for _, elem := range u {
+		if IsPublic(elem.String()) {
+			return true
+		}
+	}
+	return false
+}
+
 // getInboxes extracts the 'inbox' IRIs from actor types.
 func getInboxes(t []vocab.Type) (u []*url.URL, err error) {
 	for _, elem := range t {
@@ -384,6 +552,99 @@ func getInbox(t vocab.Type) (u *url.URL, err error) {
 	return ToId(inbox)
 }
 
+const (
+	// endpointsProperty is the actor property holding the 'sharedInbox'.
+	endpointsProperty = "endpoints"
+	// sharedInboxProperty is the endpoint shared by many actors on a server.
+	sharedInboxProperty = "sharedInbox"
+	// alsoKnownAsProperty is the actor property listing its aliases.
+	alsoKnownAsProperty = "alsoKnownAs"
+)
+
+// getSharedInbox extracts the 'endpoints.sharedInbox' IRI from an actor type.
+// Returns nil if the actor has no shared inbox.
+func getSharedInbox(t vocab.Type) *url.URL {
+	up, ok := t.(unknownPropertieser)
+	if !ok {
+		return nil
+	}
+	endpoints, ok := up.GetUnknownProperties()[endpointsProperty].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	s, ok := endpoints[sharedInboxProperty].(string)
+	if !ok {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// getAlsoKnownAs extracts the 'alsoKnownAs' IRIs from an actor type. The
+// property may be a single IRI, an object with an 'id', or a list of either.
+func getAlsoKnownAs(t vocab.Type) (iris []*url.URL) {
+	up, ok := t.(unknownPropertieser)
+	if !ok {
+		return nil
+	}
+	v := up.GetUnknownProperties()[alsoKnownAsProperty]
+	values, ok := v.([]interface{})
+	if !ok {
+		values = []interface{}{v}
+	}
+	for _, value := range values {
+		if m, ok := value.(map[string]interface{}); ok {
+			value = m["id"]
+		}
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if u, err := url.Parse(s); err == nil && u.IsAbs() {
+			iris = append(iris, u)
+		}
+	}
+	return
+}
+
+// getDeliveryInboxes extracts the inbox IRIs to deliver to from actor types.
+//
+// An actor's sharedInbox is used in place of its own inbox when the activity
+// is public, or when the actor is not among the directly addressed IRIs and
+// so is only a recipient by being in an addressed collection. This way an
+// activity is delivered once to each server instead of once per follower.
+func getDeliveryInboxes(t []vocab.Type, direct []*url.URL, public bool) (u []*url.URL, err error) {
+	directMap := make(map[string]bool, len(direct))
+	for _, elem := range direct {
+		directMap[elem.String()] = true
+	}
+	for _, elem := range t {
+		if public || !isDirectlyAddressed(elem, directMap) {
+			if shared := getSharedInbox(elem); shared != nil {
+				u = append(u, shared)
+				continue
+			}
+		}
+		var iri *url.URL
+		iri, err = getInbox(elem)
+		if err != nil {
+			return
+		}
+		u = append(u, iri)
+	}
+	return
+}
+
+// isDirectlyAddressed determines if the actor's id is in the set of addressed
+// IRIs.
+func isDirectlyAddressed(t vocab.Type, direct map[string]bool) bool {
+	id, err := GetId(t)
+	return err == nil && direct[id.String()]
+}
+
 // dedupeIRIs will deduplicate final inbox IRIs. The ignore list is applied to
 // the final list.
 func dedupeIRIs(recipients, ignored []*url.URL) (out []*url.URL) {
@@ -402,6 +663,62 @@ func dedupeIRIs(recipients, ignored []*url.URL) (out []*url.URL) {
 	return
 }
 
+// getAddressed returns the IRIs in the 'to', 'bto', 'cc', 'bcc', and
+// 'audience' properties of the activity.
+func getAddressed(activity Activity) (r []*url.URL, err error) {
+	if to := activity.GetActivityStreamsTo(); to != nil {
+		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if bto := activity.GetActivityStreamsBto(); bto != nil {
+		for iter := bto.Begin(); iter != bto.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if cc := activity.GetActivityStreamsCc(); cc != nil {
+		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if bcc := activity.GetActivityStreamsBcc(); bcc != nil {
+		for iter := bcc.Begin(); iter != bcc.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if audience := activity.GetActivityStreamsAudience(); audience != nil {
+		for iter := audience.Begin(); iter != audience.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	return
+}
+
 // stripHiddenRecipients removes "bto" and "bcc" from the activity.
 //
 // Note that this requirement of the specification is under "Section 6: Client
@@ -740,16 +1057,19 @@ func toTombstone(obj vocab.Type, id *url.URL, now time.Time) vocab.ActivityStrea
 
 // mustHaveActivityActorsMatchObjectActors ensures that the actors on types in
 // the 'object' property are all listed in the 'actor' property.
+//
+// The values of the 'object' property are returned, having been dereferenced
+// when they were only IRIs.
 func mustHaveActivityActorsMatchObjectActors(c context.Context,
 	actors vocab.ActivityStreamsActorProperty,
 	op vocab.ActivityStreamsObjectProperty,
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error),
-	boxIRI *url.URL) error {
+	boxIRI *url.URL) (objects []vocab.Type, err error) {
 	activityActorMap := make(map[string]bool, actors.Len())
 	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
 		id, err := ToId(iter)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		activityActorMap[id.String()] = true
 	}
@@ -759,41 +1079,115 @@ func mustHaveActivityActorsMatchObjectActors(c context.Context,
 			// Attempt to dereference the IRI instead
 			tport, err := newTransport(c, boxIRI, goFedUserAgent())
 			if err != nil {
-				return err
+				return nil, err
 			}
 			b, err := tport.Dereference(c, iter.GetIRI())
 			if err != nil {
-				return err
+				return nil, err
 			}
 			var m map[string]interface{}
 			if err = json.Unmarshal(b, &m); err != nil {
-				return err
+				return nil, err
 			}
 			t, err = streams.ToType(c, m)
 			if err != nil {
-				return err
+				return nil, err
 			}
-		} else {
-			return fmt.Errorf("cannot verify actors: object is neither a value nor IRI")
+		} else if t == nil {
+			return nil, fmt.Errorf("cannot verify actors: object is neither a value nor IRI")
 		}
 		ac, ok := t.(actorer)
 		if !ok {
-			return fmt.Errorf("cannot verify actors: object value has no 'actor' property")
+			return nil, fmt.Errorf("cannot verify actors: object value has no 'actor' property")
 		}
 		objActors := ac.GetActivityStreamsActor()
 		for iter := objActors.Begin(); iter != objActors.End(); iter = iter.Next() {
 			id, err := ToId(iter)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if !activityActorMap[id.String()] {
-				return fmt.Errorf("activity does not have all actors from its object's actors")
+				return nil, fmt.Errorf("activity does not have all actors from its object's actors")
 			}
 		}
+		objects = append(objects, t)
+	}
+	return
+}
+
+// mustHaveEmbeddedObjectsOnActorHosts ensures that the values embedded in the
+// 'object' property have ids on the same host as one of the actors in the
+// 'actor' property. A peer is only trusted with the values its own server
+// identifies, so that it cannot claim another actor's activity, such as a
+// Like, as its own.
+func mustHaveEmbeddedObjectsOnActorHosts(actors vocab.ActivityStreamsActorProperty, op vocab.ActivityStreamsObjectProperty) error {
+	hosts := make(map[string]bool, actors.Len())
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		hosts[id.Host] = true
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		t := iter.GetType()
+		if t == nil {
+			continue
+		}
+		id, err := GetId(t)
+		if err != nil {
+			return err
+		}
+		if !hosts[id.Host] {
+			return fmt.Errorf("embedded object %s is not on the host of an actor", id)
+		}
 	}
 	return nil
 }
 
+// removeFromCollection removes the ids from the 'items' of a Collection or the
+// 'orderedItems' of an OrderedCollection. Returns true if any were removed.
+func removeFromCollection(col vocab.Type, ids map[string]bool) (removed bool, err error) {
+	if c, ok := col.(itemser); ok {
+		items := c.GetActivityStreamsItems()
+		if items == nil {
+			return
+		}
+		for i := 0; i < items.Len(); {
+			id, err := ToId(items.At(i))
+			if err != nil {
+				return removed, err
+			}
+			if ids[id.String()] {
+				items.Remove(i)
+				removed = true
+			} else {
+				i++
+			}
+		}
+	} else if oc, ok := col.(orderedItemser); ok {
+		oItems := oc.GetActivityStreamsOrderedItems()
+		if oItems == nil {
+			return
+		}
+		for i := 0; i < oItems.Len(); {
+			id, err := ToId(oItems.At(i))
+			if err != nil {
+				return removed, err
+			}
+			if ids[id.String()] {
+				oItems.Remove(i)
+				removed = true
+			} else {
+				i++
+			}
+		}
+	} else {
+		err = fmt.Errorf("type is neither a Collection nor an OrderedCollection: %T", col)
+	}
+	return
+}
+
 // add implements the logic of adding object ids to a target Collection or
 // OrderedCollection. This logic is shared by both the C2S and S2S protocols.
 func add(c context.Context,
@@ -1,6 +1,10 @@
 package pub
 
 import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
 	"testing"
 )
 
@@ -65,6 +69,41 @@ func TestHeaderIsActivityPubMediaType(t *testing.T) {
 			"application/ld+json;profile=\"https://www.w3.org/ns/activitystreams\"",
 			true,
 		},
+		{
+			"With Profile List",
+			"application/ld+json; profile=\"https://example.com/profile https://www.w3.org/ns/activitystreams\"",
+			true,
+		},
+		{
+			"With Parameters Before Profile",
+			"application/ld+json; charset=utf-8; profile=\"https://www.w3.org/ns/activitystreams\"",
+			true,
+		},
+		{
+			"Uppercase",
+			"Application/Activity+JSON",
+			true,
+		},
+		{
+			"Zero Quality",
+			"application/activity+json;q=0",
+			false,
+		},
+		{
+			"Other Profile",
+			"application/ld+json; profile=\"https://www.w3.org/ns/activitystreams-extra\"",
+			false,
+		},
+		{
+			"Similar Type",
+			"application/activity+jsonx",
+			false,
+		},
+		{
+			"Wildcard",
+			"*/*",
+			false,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -74,3 +113,134 @@ func TestHeaderIsActivityPubMediaType(t *testing.T) {
 		})
 	}
 }
+
+func TestAcceptsActivityStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{
+			"Mastodon Accept Header",
+			"application/activity+json, application/ld+json",
+			true,
+		},
+		{
+			"Prefers HTML",
+			"text/html, application/activity+json;q=0.1",
+			false,
+		},
+		{
+			"Prefers ActivityStreams",
+			"text/html;q=0.5, application/activity+json",
+			true,
+		},
+		{
+			"Browser",
+			"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			false,
+		},
+		{
+			"Wildcard Ranked Lower",
+			"application/activity+json, */*;q=0.1",
+			true,
+		},
+		{
+			"Text Wildcard Ranked Higher",
+			"text/*, application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"; q=0.9",
+			false,
+		},
+		{
+			"HTML Refused",
+			"application/activity+json;q=0.2, text/html;q=0",
+			true,
+		},
+		{
+			"Empty",
+			"",
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := acceptsActivityStreams(test.input); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// mustToActor deserializes an actor with an inbox and optional shared inbox.
+func mustToActor(id, inbox, sharedInbox string) vocab.Type {
+	m := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Person",
+		"id":       id,
+		"inbox":    inbox,
+	}
+	if len(sharedInbox) > 0 {
+		m["endpoints"] = map[string]interface{}{
+			"sharedInbox": sharedInbox,
+		}
+	}
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestGetDeliveryInboxes(t *testing.T) {
+	const (
+		sharedInbox = "https://other.example.com/inbox"
+		inbox1      = "https://other.example.com/dakota/inbox"
+		inbox2      = "https://other.example.com/addison/inbox"
+		inbox3      = "https://maybe.example.com/person/inbox"
+	)
+	actors := []vocab.Type{
+		mustToActor(testFederatedActorIRI, inbox1, sharedInbox),
+		mustToActor(testFederatedActorIRI2, inbox2, sharedInbox),
+		mustToActor(testPersonIRI, inbox3, ""),
+	}
+	tests := []struct {
+		name     string
+		direct   []*url.URL
+		public   bool
+		expected []string
+	}{
+		{
+			"Collection Members Use Shared Inbox",
+			nil,
+			false,
+			[]string{sharedInbox, sharedInbox, inbox3},
+		},
+		{
+			"Directly Addressed Use Personal Inbox",
+			[]*url.URL{mustParse(testFederatedActorIRI)},
+			false,
+			[]string{inbox1, sharedInbox, inbox3},
+		},
+		{
+			"Public Always Uses Shared Inbox",
+			[]*url.URL{mustParse(testFederatedActorIRI), mustParse(testFederatedActorIRI2)},
+			true,
+			[]string{sharedInbox, sharedInbox, inbox3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := getDeliveryInboxes(actors, test.direct, test.public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(actual) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+			for i := range actual {
+				if actual[i].String() != test.expected[i] {
+					t.Fatalf("expected %v, got %v", test.expected, actual)
+				}
+			}
+		})
+	}
+}
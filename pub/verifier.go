@@ -0,0 +1,437 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// requestTargetHeader is the pseudo-header HTTP Signatures use to sign
+	// the method and path of a request.
+	requestTargetHeader = "(request-target)"
+	// signatureHeader is the header containing an HTTP Signature.
+	signatureHeader = "Signature"
+	// authorizationHeader may instead contain an HTTP Signature.
+	authorizationHeader = "Authorization"
+	// hostHeader is the Host header, which is commonly signed.
+	hostHeader = "Host"
+	// sha512Digest is the SHA-512 string for the Digest header.
+	sha512Digest = "SHA-512"
+)
+
+// signerContextKey is the context key for the IRI of the actor that signed a
+// verified request.
+type signerContextKey struct{}
+
+// VerifiedSigner returns the IRI of the actor owning the key that signed the
+// request, as placed into the context by HttpSigVerifier. Returns nil if the
+// context has no verified signer.
+func VerifiedSigner(c context.Context) *url.URL {
+	u, _ := c.Value(signerContextKey{}).(*url.URL)
+	return u
+}
+
+// HttpSigVerifier authenticates requests signed with HTTP Signatures by
+// fetching the signer's public key.
+//
+// Its AuthenticatePostInbox method may be used directly as the implementation
+// of FederatingProtocol.AuthenticatePostInbox.
+//
+// A request is verified only if:
+//   - its signature covers the (request-target), Date, and, if it has a body,
+//     Digest headers,
+//   - its Date is within the allowed skew of the Clock,
+//   - its Digest matches the body, and
+//   - the signature verifies against the publicKeyPem of the keyId, which
+//     must be owned by an actor on the same origin that lists it as its key.
+//
+// AuthenticatePostInbox additionally requires the signer to be an 'actor' of
+// the activity.
+//
+// No caching of public keys is done.
+type HttpSigVerifier struct {
+	newTransport func(c context.Context) (Transport, error)
+	clock        Clock
+	algos        []httpsig.Algorithm
+	maxDateSkew  time.Duration
+}
+
+// NewHttpSigVerifier returns a new HttpSigVerifier.
+//
+// The newTransport function provides the Transport used to fetch public keys
+// from peers. A signature is accepted if it verifies with any one of the given
+// algorithms, and its Date differs from the clock by no more than maxDateSkew.
+func NewHttpSigVerifier(
+	newTransport func(c context.Context) (Transport, error),
+	clock Clock,
+	algos []httpsig.Algorithm,
+	maxDateSkew time.Duration) *HttpSigVerifier {
+	return &HttpSigVerifier{
+		newTransport: newTransport,
+		clock:        clock,
+		algos:        algos,
+		maxDateSkew:  maxDateSkew,
+	}
+}
+
+// AuthenticatePostInbox verifies the HTTP Signature of the request, and that
+// the signer is one of the 'actor' of the activity POSTed.
+//
+// If it is verified, authenticated is true and the returned context contains
+// the signer, which is obtainable with VerifiedSigner. Otherwise, an
+// http.StatusUnauthorized is written to the response and authenticated is
+// false.
+//
+// An error is only returned if a Transport could not be obtained.
+func (v *HttpSigVerifier) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	out = c
+	signer, authErr, err := v.verify(c, r)
+	if err != nil {
+		return
+	} else if authErr == nil {
+		authErr = checkSignerIsActor(c, r, signer)
+	}
+	if authErr != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	out = context.WithValue(c, signerContextKey{}, signer)
+	authenticated = true
+	return
+}
+
+// Verify checks the HTTP Signature of the request, returning the IRI of the
+// actor owning the key that signed it.
+func (v *HttpSigVerifier) Verify(c context.Context, r *http.Request) (signer *url.URL, err error) {
+	signer, authErr, err := v.verify(c, r)
+	if err != nil {
+		return nil, err
+	} else if authErr != nil {
+		return nil, authErr
+	}
+	return
+}
+
+// verify checks the request. The authErr is non-nil when the request is not
+// authentic, and err is non-nil when verification could not be attempted.
+func (v *HttpSigVerifier) verify(c context.Context, r *http.Request) (signer *url.URL, authErr, err error) {
+	// Servers remove the Host header from the request, but peers commonly
+	// sign it.
+	if len(r.Header.Get(hostHeader)) == 0 && len(r.Host) > 0 {
+		r.Header.Set(hostHeader, r.Host)
+	}
+	verifier, authErr := httpsig.NewVerifier(r)
+	if authErr != nil {
+		return
+	}
+	if authErr = v.checkSignedHeaders(r); authErr != nil {
+		return
+	}
+	if authErr = v.checkDate(r); authErr != nil {
+		return
+	}
+	if authErr = checkDigest(r); authErr != nil {
+		return
+	}
+	keyIRI, authErr := url.Parse(verifier.KeyId())
+	if authErr != nil {
+		return
+	}
+	tp, err := v.newTransport(c)
+	if err != nil {
+		return
+	}
+	signer, pubKey, authErr := v.dereferenceKey(c, tp, keyIRI)
+	if authErr != nil {
+		return
+	}
+	for _, algo := range v.algos {
+		if authErr = verifier.Verify(pubKey, algo); authErr == nil {
+			return
+		}
+	}
+	if authErr == nil {
+		authErr = fmt.Errorf("no http signature algorithms configured")
+	}
+	signer = nil
+	return
+}
+
+// checkSignerIsActor ensures the signer is one of the 'actor' of the activity
+// in the request body. The request body is restored so that it may be read
+// again.
+func checkSignerIsActor(c context.Context, r *http.Request, signer *url.URL) error {
+	if r.Body == nil {
+		return fmt.Errorf("no activity in request body")
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return err
+	}
+	if a, ok := t.(actorer); ok && a.GetActivityStreamsActor() != nil {
+		for iter := a.GetActivityStreamsActor().Begin(); iter != a.GetActivityStreamsActor().End(); iter = iter.Next() {
+			if iri, err := ToId(iter); err == nil && iri.String() == signer.String() {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("signer %s is not an actor of the activity", signer)
+}
+
+// checkSignedHeaders ensures the signature covers the headers needed to
+// prevent the request being replayed or altered.
+func (v *HttpSigVerifier) checkSignedHeaders(r *http.Request) error {
+	signed := signedHeaders(r)
+	required := []string{requestTargetHeader, strings.ToLower(dateHeader)}
+	if r.ContentLength != 0 && r.Body != nil {
+		required = append(required, strings.ToLower(digestHeader))
+	}
+	for _, req := range required {
+		found := false
+		for _, s := range signed {
+			if s == req {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("http signature does not cover %q", req)
+		}
+	}
+	return nil
+}
+
+// checkDate ensures the Date header is not too far from the current time.
+func (v *HttpSigVerifier) checkDate(r *http.Request) error {
+	d, err := http.ParseTime(r.Header.Get(dateHeader))
+	if err != nil {
+		return err
+	}
+	skew := v.clock.Now().Sub(d)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > v.maxDateSkew {
+		return fmt.Errorf("date %s is outside the allowed skew of %s", d, v.maxDateSkew)
+	}
+	return nil
+}
+
+// dereferenceKey fetches the key with the given id, returning its owner and
+// the parsed public key.
+//
+// The keyId may either be the IRI of a standalone key, or refer to a key
+// embedded within its owning actor, such as "https://example.com/actor#key".
+// An embedded key must be in the document whose id is the keyId without its
+// fragment. A standalone key must be owned by an actor of the same origin,
+// which is also fetched to ensure it lists the key as its own.
+func (v *HttpSigVerifier) dereferenceKey(c context.Context, tp Transport, keyIRI *url.URL) (owner *url.URL, pubKey crypto.PublicKey, err error) {
+	t, err := dereferenceType(c, tp, keyIRI)
+	if err != nil {
+		return
+	}
+	key, isKey := t.(vocab.W3IDSecurityV1PublicKey)
+	if !isKey {
+		// An embedded key must be owned by the actor embedding it,
+		// which must be the document the keyId refers to.
+		var actorId *url.URL
+		actorId, err = GetId(t)
+		if err != nil {
+			return
+		}
+		docIRI := *keyIRI
+		docIRI.Fragment = ""
+		if actorId.String() != docIRI.String() {
+			err = fmt.Errorf("public key %s fetched from %s", keyIRI, actorId)
+			return
+		}
+		key, _ = findPublicKey(t, keyIRI)
+		if key != nil {
+			if o := key.GetW3IDSecurityV1Owner(); o == nil || o.Get().String() != actorId.String() {
+				err = fmt.Errorf("public key %s is not owned by %s", keyIRI, actorId)
+				return
+			}
+		}
+	}
+	if key == nil {
+		err = fmt.Errorf("no public key %s found", keyIRI)
+		return
+	} else if id := key.GetJSONLDId(); id == nil || id.Get().String() != keyIRI.String() {
+		err = fmt.Errorf("public key id does not match %s", keyIRI)
+		return
+	} else if o := key.GetW3IDSecurityV1Owner(); o == nil || o.Get() == nil {
+		err = fmt.Errorf("public key %s has no owner", keyIRI)
+		return
+	} else if p := key.GetW3IDSecurityV1PublicKeyPem(); p == nil || !p.IsXMLSchemaString() {
+		err = fmt.Errorf("public key %s has no publicKeyPem", keyIRI)
+		return
+	}
+	owner = key.GetW3IDSecurityV1Owner().Get()
+	if isKey {
+		// A standalone key is only trusted if its owner, on the same
+		// origin, claims it.
+		if owner.Scheme != keyIRI.Scheme || owner.Host != keyIRI.Host {
+			err = fmt.Errorf("public key %s is not on the origin of its owner %s", keyIRI, owner)
+			return
+		}
+		var ownerType vocab.Type
+		ownerType, err = dereferenceType(c, tp, owner)
+		if err != nil {
+			return
+		}
+		if _, listed := findPublicKey(ownerType, keyIRI); !listed {
+			err = fmt.Errorf("owner %s does not list public key %s", owner, keyIRI)
+			return
+		}
+	}
+	pubKey, err = parsePublicKeyPem(key.GetW3IDSecurityV1PublicKeyPem().Get())
+	return
+}
+
+// dereferenceType fetches the IRI and deserializes it into an ActivityStreams
+// type.
+func dereferenceType(c context.Context, tp Transport, iri *url.URL) (vocab.Type, error) {
+	b, err := tp.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// findPublicKey looks for the key in the 'publicKey' property of the type. The
+// key is returned if it is embedded, and listed is true if it is either
+// embedded or referred to by its IRI.
+func findPublicKey(t vocab.Type, keyIRI *url.URL) (key vocab.W3IDSecurityV1PublicKey, listed bool) {
+	pk, ok := t.(publicKeyer)
+	if !ok || pk.GetW3IDSecurityV1PublicKey() == nil {
+		return
+	}
+	for iter := pk.GetW3IDSecurityV1PublicKey().Begin(); iter != pk.GetW3IDSecurityV1PublicKey().End(); iter = iter.Next() {
+		if iter.IsIRI() && iter.GetIRI().String() == keyIRI.String() {
+			listed = true
+		} else if iter.IsW3IDSecurityV1PublicKey() {
+			if id := iter.Get().GetJSONLDId(); id != nil && id.Get().String() == keyIRI.String() {
+				return iter.Get(), true
+			}
+		}
+	}
+	return
+}
+
+// signatureParam returns the unquoted value of a parameter of the request's
+// HTTP Signature, from either the Signature or the Authorization header. The
+// boolean is false if the parameter is absent.
+func signatureParam(r *http.Request, name string) (string, bool) {
+	s := r.Header.Get(signatureHeader)
+	if len(s) == 0 {
+		s = strings.TrimPrefix(r.Header.Get(authorizationHeader), signatureHeader+" ")
+	}
+	for _, p := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 && kv[0] == name {
+			return strings.Trim(kv[1], "\""), true
+		}
+	}
+	return "", false
+}
+
+// signedHeaders returns the lowercased headers covered by the request's HTTP
+// Signature.
+func signedHeaders(r *http.Request) []string {
+	if h, ok := signatureParam(r, "headers"); ok {
+		return strings.Split(strings.ToLower(h), " ")
+	}
+	// Per the HTTP Signatures specification, only the Date header is
+	// signed when the headers parameter is absent.
+	return []string{strings.ToLower(dateHeader)}
+}
+
+// checkDigest ensures every supported algorithm in the Digest header matches
+// the request body, and that at least one is present. The request body is
+// restored so that it may be read again.
+func checkDigest(r *http.Request) error {
+	if r.Body == nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if len(b) == 0 && len(r.Header.Get(digestHeader)) == 0 {
+		return nil
+	}
+	matched := false
+	for _, d := range strings.Split(r.Header.Get(digestHeader), ",") {
+		kv := strings.SplitN(strings.TrimSpace(d), digestDelimiter, 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var h hash.Hash
+		switch strings.ToUpper(kv[0]) {
+		case sha256Digest:
+			h = sha256.New()
+		case sha512Digest:
+			h = sha512.New()
+		default:
+			continue
+		}
+		// Peers using go-fed/httpsig at the version pinned by this
+		// library, including HttpSigTransport, encode the body followed
+		// by the digest of nothing, so that form is also accepted.
+		legacy := base64.StdEncoding.EncodeToString(h.Sum(b))
+		h.Write(b)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != kv[1] && legacy != kv[1] {
+			return fmt.Errorf("%s digest does not match body", kv[0])
+		}
+		matched = true
+	}
+	if !matched {
+		return fmt.Errorf("no supported digest in %q header", digestHeader)
+	}
+	return nil
+}
+
+// parsePublicKeyPem parses a PEM-encoded PKIX or PKCS1 public key.
+func parsePublicKeyPem(s string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("could not decode publicKeyPem")
+	}
+	if k, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
@@ -0,0 +1,302 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testPublicKeyIRI           = "https://other.example.com/dakota#main-key"
+	testStandalonePublicKeyIRI = "https://other.example.com/keys/dakota"
+	testForeignPublicKeyIRI    = "https://evil.example.com/keys/dakota"
+)
+
+// toPublicKey creates the public key with the id and owner.
+func toPublicKey(pub *rsa.PublicKey, keyIRI, ownerIRI string) vocab.W3IDSecurityV1PublicKey {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		panic(err)
+	}
+	key := streams.NewW3IDSecurityV1PublicKey()
+	keyId := streams.NewJSONLDIdProperty()
+	keyId.Set(mustParse(keyIRI))
+	key.SetJSONLDId(keyId)
+	owner := streams.NewW3IDSecurityV1OwnerProperty()
+	owner.Set(mustParse(ownerIRI))
+	key.SetW3IDSecurityV1Owner(owner)
+	keyPem := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	keyPem.Set(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	key.SetW3IDSecurityV1PublicKeyPem(keyPem)
+	return key
+}
+
+// toActorWithKey creates a Person with the id, embedding the public key.
+func toActorWithKey(actorIRI string, key vocab.W3IDSecurityV1PublicKey) vocab.ActivityStreamsPerson {
+	person := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(actorIRI))
+	person.SetJSONLDId(id)
+	pk := streams.NewW3IDSecurityV1PublicKeyProperty()
+	pk.AppendW3IDSecurityV1PublicKey(key)
+	person.SetW3IDSecurityV1PublicKey(pk)
+	return person
+}
+
+// mustSerializeActorWithKey serializes a Person owning the public key.
+func mustSerializeActorWithKey(pub *rsa.PublicKey) []byte {
+	return mustSerializeToBytes(toActorWithKey(testFederatedActorIRI, toPublicKey(pub, testPublicKeyIRI, testFederatedActorIRI)))
+}
+
+// mustSerializeStandaloneKey serializes the public key as its own document.
+func mustSerializeStandaloneKey(key vocab.W3IDSecurityV1PublicKey) []byte {
+	m := mustSerialize(key)
+	m["type"] = key.GetTypeName()
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// mustSignRequest creates a POST request with a Digest, signed with the key.
+//
+// If digest is empty, the signer adds the Digest header.
+func mustSignRequest(priv *rsa.PrivateKey, date time.Time, body []byte, digest string) *http.Request {
+	return mustSignRequestWithKeyId(priv, testPublicKeyIRI, date, body, digest)
+}
+
+// mustSignRequestWithKeyId creates a POST request with a Digest, signed with
+// the key identified by the keyId.
+func mustSignRequestWithKeyId(priv *rsa.PrivateKey, keyId string, date time.Time, body []byte, digest string) *http.Request {
+	r := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewReader(body))
+	r.Header.Set(dateHeader, date.UTC().Format(http.TimeFormat))
+	r.Header.Set("Host", r.Host)
+	signBody := body
+	if len(digest) > 0 {
+		r.Header.Set(digestHeader, digest)
+		signBody = nil
+	}
+	signer, _, err := httpsig.NewSigner(
+		[]httpsig.Algorithm{httpsig.RSA_SHA256},
+		httpsig.DigestSha256,
+		[]string{requestTargetHeader, "host", "date", "digest"},
+		httpsig.Signature)
+	if err != nil {
+		panic(err)
+	}
+	if err = signer.SignRequest(priv, keyId, r, signBody); err != nil {
+		panic(err)
+	}
+	// Servers do not keep the Host header.
+	r.Header.Del("Host")
+	return r
+}
+
+// TestHttpSigVerifier tests verifying HTTP Signatures of inbox requests.
+func TestHttpSigVerifier(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	body := []byte(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Create","actor":"` + testFederatedActorIRI + `"}`)
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actor := mustSerializeActorWithKey(&priv.PublicKey)
+	setupFn := func(ctl *gomock.Controller) (tp *MockTransport, v *HttpSigVerifier) {
+		tp = NewMockTransport(ctl)
+		cl := NewMockClock(ctl)
+		cl.EXPECT().Now().Return(now).AnyTimes()
+		v = NewHttpSigVerifier(func(c context.Context) (Transport, error) {
+			return tp, nil
+		}, cl, []httpsig.Algorithm{httpsig.RSA_SHA256}, time.Minute)
+		return
+	}
+	t.Run("AuthenticatesValidSignature", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequest(priv, now, body, "")
+		tp.EXPECT().Dereference(ctx, mustParse(testPublicKeyIRI)).Return(actor, nil)
+		// Run
+		c, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		assertEqual(t, VerifiedSigner(c).String(), testFederatedActorIRI)
+		restored, _ := ioutil.ReadAll(req.Body)
+		assertByteEqual(t, restored, body)
+	})
+	t.Run("AuthenticatesStandardDigest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		sum := sha256.Sum256(body)
+		req := mustSignRequest(priv, now, body, "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		tp.EXPECT().Dereference(ctx, mustParse(testPublicKeyIRI)).Return(actor, nil)
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+	})
+	t.Run("RejectsTamperedBody", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequest(priv, now, body, "")
+		req.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"type":"Delete"}`)))
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsStaleDate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequest(priv, now.Add(-time.Hour), body, "")
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsWrongKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := mustSignRequest(other, now, body, "")
+		tp.EXPECT().Dereference(ctx, mustParse(testPublicKeyIRI)).Return(actor, nil)
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("AuthenticatesStandaloneKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequestWithKeyId(priv, testStandalonePublicKeyIRI, now, body, "")
+		key := toPublicKey(&priv.PublicKey, testStandalonePublicKeyIRI, testFederatedActorIRI)
+		tp.EXPECT().Dereference(ctx, mustParse(testStandalonePublicKeyIRI)).Return(mustSerializeStandaloneKey(key), nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(mustSerializeToBytes(toActorWithKey(testFederatedActorIRI, key)), nil)
+		// Run
+		c, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		assertEqual(t, VerifiedSigner(c).String(), testFederatedActorIRI)
+	})
+	t.Run("RejectsKeyClaimingForeignOwner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequestWithKeyId(priv, testForeignPublicKeyIRI, now, body, "")
+		key := toPublicKey(&priv.PublicKey, testForeignPublicKeyIRI, testFederatedActorIRI)
+		tp.EXPECT().Dereference(ctx, mustParse(testForeignPublicKeyIRI)).Return(mustSerializeStandaloneKey(key), nil)
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsKeyNotListedByOwner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequestWithKeyId(priv, testStandalonePublicKeyIRI, now, body, "")
+		key := toPublicKey(&priv.PublicKey, testStandalonePublicKeyIRI, testFederatedActorIRI)
+		tp.EXPECT().Dereference(ctx, mustParse(testStandalonePublicKeyIRI)).Return(mustSerializeStandaloneKey(key), nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(actor, nil)
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsEmbeddedKeyInOtherDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequest(priv, now, body, "")
+		other := toActorWithKey(testFederatedActorIRI2, toPublicKey(&priv.PublicKey, testPublicKeyIRI, testFederatedActorIRI2))
+		tp.EXPECT().Dereference(ctx, mustParse(testPublicKeyIRI)).Return(mustSerializeToBytes(other), nil)
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsSignerNotActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, v := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := mustSignRequest(priv, now, []byte(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Create","actor":"`+testFederatedActorIRI2+`"}`), "")
+		tp.EXPECT().Dereference(ctx, mustParse(testPublicKeyIRI)).Return(actor, nil)
+		// Run
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsUnsignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, v := setupFn(ctl)
+		req := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewReader(body))
+		// Run
+		_, err := v.Verify(ctx, req)
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+}
@@ -0,0 +1,217 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// WebfingerPath is the well-known path of the WebFinger endpoint, per
+	// RFC 7033 §10.1.
+	WebfingerPath = "/.well-known/webfinger"
+	// jrdContentType is the media type of a JSON Resource Descriptor.
+	jrdContentType = "application/jrd+json"
+	// acctScheme is the scheme of account URIs, per RFC 7565.
+	acctScheme = "acct"
+	// selfRel is the link relation of an actor's ActivityStreams document.
+	selfRel = "self"
+	// resourceQuery is the WebFinger query parameter naming the resource.
+	resourceQuery = "resource"
+	// relQuery is the WebFinger query parameter filtering link relations.
+	relQuery = "rel"
+)
+
+// JRDLink is a link of a JSON Resource Descriptor, per RFC 7033 §4.4.4.
+type JRDLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+// JRD is a JSON Resource Descriptor, per RFC 7033 §4.4.
+type JRD struct {
+	Subject string    `json:"subject"`
+	Aliases []string  `json:"aliases,omitempty"`
+	Links   []JRDLink `json:"links,omitempty"`
+}
+
+// WebfingerLookup finds the IRI of the local actor identified by a WebFinger
+// resource, such as "acct:alex@example.com" or the actor's IRI itself.
+//
+// A nil actorIRI and nil error means no actor was found.
+type WebfingerLookup func(c context.Context, resource *url.URL) (actorIRI *url.URL, err error)
+
+// NewWebfingerHandler creates a HandlerFunc that serves WebFinger requests, per
+// RFC 7033, for the actors found by the lookup.
+//
+// The returned HandlerFunc reports whether the request was a GET request to the
+// WebFinger path. The response is a JRD with the actor's IRI as an alias, and
+// 'self' links to it with the ActivityStreams media types. Requests without a
+// resource are answered with http.StatusBadRequest, and resources without an
+// actor with http.StatusNotFound.
+func NewWebfingerHandler(lookup WebfingerLookup) HandlerFunc {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isWebfingerRequest bool, err error) {
+		if r.Method != "GET" || r.URL.Path != WebfingerPath {
+			return
+		}
+		isWebfingerRequest = true
+		q := r.URL.Query()
+		resource, perr := url.Parse(q.Get(resourceQuery))
+		if perr != nil || len(q.Get(resourceQuery)) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		actorIRI, err := lookup(c, resource)
+		if err != nil {
+			return
+		} else if actorIRI == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		jrd := toActorJRD(resource, actorIRI)
+		// RFC 7033 §4.3: only return the requested link relations.
+		if rels, ok := q[relQuery]; ok {
+			var links []JRDLink
+			for _, l := range jrd.Links {
+				for _, rel := range rels {
+					if l.Rel == rel {
+						links = append(links, l)
+						break
+					}
+				}
+			}
+			jrd.Links = links
+		}
+		raw, err := json.Marshal(jrd)
+		if err != nil {
+			return
+		}
+		w.Header().Set(contentTypeHeader, jrdContentType)
+		// RFC 7033 §5: WebFinger resources should be available to any
+		// origin.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+		n, err := w.Write(raw)
+		if err != nil {
+			return
+		} else if n != len(raw) {
+			err = fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+			return
+		}
+		return
+	}
+}
+
+// toActorJRD creates the JRD describing the actor.
+func toActorJRD(resource, actorIRI *url.URL) JRD {
+	return JRD{
+		Subject: resource.String(),
+		Aliases: []string{actorIRI.String()},
+		Links: []JRDLink{
+			{
+				Rel:  selfRel,
+				Type: activityJSONMediaType,
+				Href: actorIRI.String(),
+			},
+			{
+				Rel:  selfRel,
+				Type: contentTypeHeaderValue,
+				Href: actorIRI.String(),
+			},
+		},
+	}
+}
+
+// WebfingerClient resolves WebFinger handles, such as "alex@example.com", to
+// the IRIs of their actors.
+type WebfingerClient struct {
+	client     HttpClient
+	appAgent   string
+	gofedAgent string
+}
+
+// NewWebfingerClient creates a WebfingerClient sending requests with the
+// client.
+//
+// The appAgent identifies the calling application's requests, as for
+// NewHttpSigTransport.
+func NewWebfingerClient(client HttpClient, appAgent string) *WebfingerClient {
+	return &WebfingerClient{
+		client:     client,
+		appAgent:   appAgent,
+		gofedAgent: goFedUserAgent(),
+	}
+}
+
+// Resolve finds the IRI of the actor for the handle, which may be of the form
+// "alex@example.com", "@alex@example.com", or "acct:alex@example.com".
+func (w *WebfingerClient) Resolve(c context.Context, handle string) (*url.URL, error) {
+	resource, host, err := parseAcct(handle)
+	if err != nil {
+		return nil, err
+	}
+	jrd, err := w.Lookup(c, host, resource)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range jrd.Links {
+		if l.Rel == selfRel && headerIsActivityPubMediaType(l.Type) {
+			return url.Parse(l.Href)
+		}
+	}
+	return nil, fmt.Errorf("webfinger for %s has no ActivityStreams self link", resource)
+}
+
+// Lookup fetches the JRD of the resource from the WebFinger endpoint of the
+// host.
+func (w *WebfingerClient) Lookup(c context.Context, host, resource string) (*JRD, error) {
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     WebfingerPath,
+		RawQuery: url.Values{resourceQuery: []string{resource}}.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c)
+	req.Header.Add(acceptHeader, jrdContentType)
+	req.Header.Add("User-Agent", fmt.Sprintf("%s %s", w.appAgent, w.gofedAgent))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET request to %s failed (%d): %s", u.String(), resp.StatusCode, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	jrd := &JRD{}
+	if err = json.Unmarshal(b, jrd); err != nil {
+		return nil, err
+	}
+	return jrd, nil
+}
+
+// parseAcct parses a handle into its "acct:" resource and the host serving
+// its WebFinger endpoint.
+func parseAcct(handle string) (resource, host string, err error) {
+	h := strings.TrimPrefix(strings.TrimPrefix(handle, acctScheme+":"), "@")
+	at := strings.LastIndex(h, "@")
+	if at <= 0 || at == len(h)-1 {
+		err = fmt.Errorf("handle %q is not of the form user@host", handle)
+		return
+	}
+	host = h[at+1:]
+	resource = acctScheme + ":" + h
+	return
+}